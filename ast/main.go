@@ -0,0 +1,69 @@
+package main
+
+import (
+	blob "azurestoragetools/blob/Command"
+	"azurestoragetools/common"
+	queue "azurestoragetools/queue/Command"
+	table "azurestoragetools/table/Command"
+	"fmt"
+	"io"
+	"os"
+)
+
+var Version string
+
+var tools = []common.Tool{blob.Tool, queue.Tool, table.Tool}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: ast <tool> <command> [flags]\n\nAzure Storage Tools.\n\nTools:\n")
+	for _, tool := range tools {
+		fmt.Fprintf(w, "  %-16s %s\n", tool.Name, tool.Summary)
+	}
+	fmt.Fprintf(w, "\nOther commands:\n")
+	fmt.Fprintf(w, "  %-16s %s\n", "version", "Display Version")
+	fmt.Fprintf(w, "  %-16s %s\n", "completion", "Generate shell completion script, ast completion bash|zsh|fish")
+	fmt.Fprintf(w, "\nUse \"ast <tool> help\" for the commands of a tool.\n")
+}
+
+// ast is blob, queue and table in one binary. eg ast blob upload -container temp -local myfile
+func main() {
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout)
+		return
+
+	case "version", "-version":
+		fmt.Println("Version: " + Version)
+		return
+
+	case "completion":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "Usage: ast completion bash|zsh|fish")
+			os.Exit(2)
+		}
+
+		script, err := common.CompletionScript(args[1], "ast", tools)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Print(script)
+		return
+	}
+
+	for _, tool := range tools {
+		if tool.Name == args[0] {
+			os.Exit(tool.Main("ast "+tool.Name, args[1:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown tool %s\n\n", args[0])
+	usage(os.Stderr)
+	os.Exit(2)
+}
@@ -0,0 +1,10 @@
+#!/bin/sh
+
+for i in bin/*
+do
+  echo $i
+  mv $i ast
+  tar -cf $i.tar ast
+  bzip2 -9 $i.tar
+done
+
@@ -0,0 +1,378 @@
+package Command
+
+import (
+	"azurestoragetools/blob/Handler"
+	"azurestoragetools/common"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Tool is astblob, "ast blob".
+var Tool = common.Tool{
+	Name:    "blob",
+	Summary: "Azure Storage Tools Blob. Upload, download, sync and copy blobs, manage containers and generate SAS URLs.",
+	Subcommands: []common.Subcommand{
+		{Name: "upload", Command: common.CommandUpload, Summary: "Upload from local filesystem to Azure", Flags: uploadFlags},
+		{Name: "download", Command: common.CommandDownload, Summary: "Download to local filesystem from Azure", Flags: downloadFlags},
+		{Name: "list", Command: common.CommandListBlobs, Summary: "List blobs in container", Flags: listFlags},
+		{Name: "listcontainers", Command: common.CommandListContainers, Summary: "List available containers", Flags: listContainersFlags},
+		{Name: "createcontainer", Command: common.CommandCreateContainer, Summary: "Create container for Azure", Flags: containerFlags},
+		{Name: "delete", Command: common.CommandDelete, Summary: "Delete blob (or all blobs matching blobprefix) from container", Flags: deleteFlags},
+		{Name: "sync", Command: common.CommandSync, Summary: "Sync local directory and container, only new or changed files are copied", Flags: syncFlags},
+		{Name: "copy", Command: common.CommandCopy, Summary: "Copy blob (or all blobs matching blobprefix) between containers/accounts or S3. Copy is done by Azure", Flags: copyFlags},
+		{Name: "verify", Command: common.CommandVerify, Summary: "Compare local files with their blobs (size and MD5), reporting any that don't match", Flags: verifyFlags},
+		{Name: "blobsas", Command: common.CommandSASURLBlob, Summary: "Generate Blob SAS URL", Flags: blobSASFlags},
+		{Name: "containersas", Command: common.CommandSASURLContainer, Summary: "Generate Container SAS URL", Flags: containerSASFlags},
+	},
+	Run: run,
+}
+
+// commandPermissions are the SAS permissions each command needs, checked up front when only a SAS token is given.
+var commandPermissions = map[int]string{
+	common.CommandUpload:          "rw",
+	common.CommandDownload:        "rl",
+	common.CommandListBlobs:       "l",
+	common.CommandListContainers:  "l",
+	common.CommandCreateContainer: "c",
+	common.CommandDelete:          "ld",
+	common.CommandSync:            "rlw",
+	common.CommandCopy:            "rlw",
+	common.CommandVerify:          "l",
+}
+
+// commandNames are used in errors.
+var commandNames = map[int]string{
+	common.CommandUpload:          "upload",
+	common.CommandDownload:        "download",
+	common.CommandListBlobs:       "list",
+	common.CommandListContainers:  "listcontainers",
+	common.CommandCreateContainer: "createcontainer",
+	common.CommandDelete:          "delete",
+	common.CommandSync:            "sync",
+	common.CommandCopy:            "copy",
+	common.CommandVerify:          "verify",
+	common.CommandSASURLBlob:      "blobsas",
+	common.CommandSASURLContainer: "containersas",
+}
+
+func containerFlags(f *common.Flags) {
+	f.AccountFlags()
+	f.String(common.Container, "container", "", "Container used for command")
+}
+
+func listFlags(f *common.Flags) {
+	containerFlags(f)
+	outputFlags(f)
+	filterFlags(f)
+	f.String(common.BlobPrefix, "blobprefix", "", "Optional: Only list blobs starting with the prefix, eg logs/2026/")
+	f.String(common.Delimiter, "delimiter", "", "Optional: Group blobs into virtual directories by the delimiter (eg /), listing just the level below blobprefix")
+	f.Bool(&f.Config().Tree, "tree", "Optional: List blobs as a tree of virtual directories, with the size and count of each")
+	f.Bool(&f.Config().DiskUsage, "du", "Optional: List the total size and count of each virtual directory below blobprefix")
+}
+
+func listContainersFlags(f *common.Flags) {
+	f.AccountFlags()
+	outputFlags(f)
+}
+
+func outputFlags(f *common.Flags) {
+	f.StringDefault(common.Output, "output", common.OutputText, "Optional: Output format, text (names only), json, csv or table. Access tier isn't available with this storage SDK")
+	maxResultsFlags(f)
+}
+
+// filterFlags pick which files/blobs upload, download, list, delete and copy work on.
+func filterFlags(f *common.Flags) {
+	f.Strings(common.Include, "include", "Optional: Only files/blobs matching the glob (eg *.log, logs/**) or regex:expression. Can be repeated")
+	f.Strings(common.Exclude, "exclude", "Optional: Skip files/blobs matching the glob or regex:expression. Can be repeated. Patterns in .astignore in the local directory are also excluded")
+	f.String(common.NewerThan, "newer-than", "", "Optional: Only files/blobs modified after the date (eg 2026-01-31 or RFC3339) or within the age (eg 36h, 7d)")
+	f.String(common.LargerThan, "larger-than", "", "Optional: Only files/blobs larger than the size (eg 10M)")
+}
+
+// overwriteFlags are used by upload and download.
+func overwriteFlags(f *common.Flags) {
+	f.StringDefault(common.Replace, "overwrite", common.OverwriteAlways, "Optional: What to do when the destination exists. always, never, ifnewer (source modified after destination) or ifdifferent (size or MD5 differs)")
+}
+
+// contentFlags override the properties of uploaded blobs, otherwise they come from the profile's rules or are detected.
+func contentFlags(f *common.Flags) {
+	f.String(common.ContentType, "contenttype", "", "Optional: Content type of the uploaded blobs. Defaults to detecting it from the extension or content")
+	f.String(common.CacheControl, "cachecontrol", "", "Optional: Cache-Control of the uploaded blobs, eg max-age=3600")
+	f.String(common.ContentDisposition, "contentdisposition", "", "Optional: Content-Disposition of the uploaded blobs, eg attachment")
+}
+
+func maxResultsFlags(f *common.Flags) {
+	f.String(common.MaxResults, "maxresults", "", "Optional: Maximum number of blobs (or containers) listed. Defaults to no limit")
+}
+
+// transferFlags are used by every command that moves blobs around.
+func transferFlags(f *common.Flags) {
+	containerFlags(f)
+	f.Uint(&f.Config().ConcurrentCount, "cc", "Concurrent Count. How many blobs are copied concurrently. Defaults to 5")
+}
+
+func blockFlags(f *common.Flags) {
+	f.Bool(&f.Config().Resume, "resume", "Optional: Resume previously interrupted uploads, only blocks not already in Azure are uploaded")
+	f.String(common.JournalDir, "journaldir", "", "Optional: Directory for upload journals (used by resume). Defaults to ~/.ast/journal")
+	f.String(common.BlockSize, "blocksize", "", "Optional: Block size for uploads (eg 4M). Defaults to automatic based on file size")
+	f.StringDefault(common.BlockConcurrency, "blockcc", "4", "Optional: Number of blocks of a single file uploaded concurrently")
+	f.StringDefault(common.MemoryBudget, "maxmemory", "256M", "Optional: Maximum memory used for upload block buffers")
+}
+
+func uploadFlags(f *common.Flags) {
+	transferFlags(f)
+	filterFlags(f)
+	overwriteFlags(f)
+	contentFlags(f)
+	blockFlags(f)
+	f.String(common.Local, "local", "", "Path for local filesystem")
+	f.String(common.SASURL, "sasurl", "", "Optional: Container or blob SAS URL to upload to, no account credentials needed")
+}
+
+func downloadFlags(f *common.Flags) {
+	transferFlags(f)
+	filterFlags(f)
+	overwriteFlags(f)
+	maxResultsFlags(f)
+	f.String(common.Local, "local", "", "Path for local filesystem")
+	f.String(common.BlobPrefix, "blobprefix", "", "Optional: BlobPrefix for download command. This can either be entire blob name or just a prefix.")
+	f.String(common.SASURL, "sasurl", "", "Optional: Container or blob SAS URL to download from, no account credentials needed")
+}
+
+func deleteFlags(f *common.Flags) {
+	transferFlags(f)
+	filterFlags(f)
+	maxResultsFlags(f)
+	f.String(common.BlobPrefix, "blobprefix", "", "BlobPrefix of blobs to delete. This can either be entire blob name or just a prefix.")
+	f.String(common.DeleteSnapshots, "deletesnapshots", "", "Optional: Snapshot handling for delete command. include (delete blob and its snapshots) or only (delete just the snapshots)")
+}
+
+func syncFlags(f *common.Flags) {
+	transferFlags(f)
+	blockFlags(f)
+	f.String(common.Local, "local", "", "Path for local filesystem")
+	f.StringDefault(common.SyncDirection, "direction", common.SyncUp, "Optional: Direction for sync command. up (local to container) or down (container to local)")
+	f.Bool(&f.Config().Mirror, "mirror", "Optional: Sync deletes anything at the destination that doesn't exist at the source")
+	f.Bool(&f.Config().CheckMD5, "checkmd5", "Optional: Sync compares MD5 of files instead of last modified time")
+}
+
+func copyFlags(f *common.Flags) {
+	transferFlags(f)
+	filterFlags(f)
+	blockFlags(f)
+	contentFlags(f)
+	f.String(common.BlobPrefix, "blobprefix", "", "Optional: BlobPrefix of blobs to copy. This can either be entire blob name or just a prefix.")
+	f.String(common.DestContainer, "destcontainer", "", "Optional: Destination container for copy command. Defaults to container")
+	f.String(common.Source, "source", "", "Optional: S3 source for copy command (s3://bucket/prefix). Objects are copied into container")
+	f.String(common.Dest, "dest", "", "Optional: S3 destination for copy command (s3://bucket/prefix). Blobs from container are copied into it")
+
+	f.String(common.AzureSourceAccountName, "AzureSourceAccountName", "SOURCE_ACCOUNT_NAME", "Optional: Source Azure Account Name for copy. Defaults to default account")
+	f.String(common.AzureSourceAccountKey, "AzureSourceAccountKey", "SOURCE_ACCOUNT_KEY", "Optional: Source Azure Account Key for copy")
+	f.String(common.AzureDestAccountName, "AzureDestAccountName", "DEST_ACCOUNT_NAME", "Optional: Destination Azure Account Name for copy. Defaults to default account")
+	f.String(common.AzureDestAccountKey, "AzureDestAccountKey", "DEST_ACCOUNT_KEY", "Optional: Destination Azure Account Key for copy")
+
+	f.String(common.S3DefaultAccessID, "S3DefaultAccessID", "AWS_ACCESS_KEY_ID", "Default S3 Access ID")
+	f.String(common.S3DefaultAccessSecret, "S3DefaultAccessSecret", "AWS_SECRET_ACCESS_KEY", "Default S3 Access Secret")
+	f.String(common.S3DefaultRegion, "S3DefaultRegion", "AWS_REGION", "Default S3 Region")
+	f.String(common.S3SourceAccessID, "S3SourceAccessID", "", "Optional: Source S3 Access ID. Defaults to default S3 credentials")
+	f.String(common.S3SourceAccessSecret, "S3SourceAccessSecret", "", "Optional: Source S3 Access Secret")
+	f.String(common.S3SourceRegion, "S3SourceRegion", "", "Optional: Source S3 Region")
+	f.String(common.S3DestAccessID, "S3DestAccessID", "", "Optional: Destination S3 Access ID. Defaults to default S3 credentials")
+	f.String(common.S3DestAccessSecret, "S3DestAccessSecret", "", "Optional: Destination S3 Access Secret")
+	f.String(common.S3DestRegion, "S3DestRegion", "", "Optional: Destination S3 Region")
+	f.String(common.S3Endpoint, "s3endpoint", "", "Optional: Endpoint for S3 compatible storage, eg http://localhost:9000 for MinIO")
+}
+
+func verifyFlags(f *common.Flags) {
+	transferFlags(f)
+	filterFlags(f)
+	f.String(common.Local, "local", "", "Path for local filesystem")
+	f.String(common.BlobPrefix, "blobprefix", "", "Optional: Only verify blobs (and local files) starting with the prefix")
+}
+
+func blobSASFlags(f *common.Flags) {
+	containerFlags(f)
+	f.String(common.BlobPrefix, "blobprefix", "", "Blob to generate the SAS URL for")
+	f.SASFlags("racwd")
+}
+
+func containerSASFlags(f *common.Flags) {
+	containerFlags(f)
+	f.SASFlags("racwdl")
+}
+
+// run validates the configuration then runs the command.
+func run(config *common.CloudConfig) error {
+
+	// everything is checked before talking to Azure.
+	opts, err := validateOptions(config)
+	if err != nil {
+		return err
+	}
+	log.Debugf("options %s", opts)
+
+	if opts.SASURL != "" {
+		return runWithSASURL(opts)
+	}
+
+	bh, err := Handler.NewBlobHandler(opts.Account, opts.ConcurrentCount)
+	if err != nil {
+		return err
+	}
+	bh.SetMaxResults(opts.MaxResults)
+	bh.SetFilter(opts.Filter)
+	bh.SetDryRun(opts.DryRun)
+	bh.SetOverwrite(opts.Overwrite)
+	bh.SetContentSettings(opts.Content)
+
+	// only the commands that upload blocks have block options.
+	if opts.Command == common.CommandUpload || opts.Command == common.CommandSync || opts.Command == common.CommandCopy {
+		if err := setUploadBlocks(bh, opts.Blocks); err != nil {
+			return err
+		}
+	}
+
+	switch opts.Command {
+	case common.CommandUpload:
+		return bh.UploadFiles(opts.Upload.Local, opts.Upload.Container)
+
+	case common.CommandDownload:
+		return bh.DownloadFiles(opts.Download.Container, opts.Download.BlobPrefix, opts.Download.Local)
+
+	case common.CommandVerify:
+		return bh.VerifyFiles(opts.Verify.Local, opts.Verify.Container, opts.Verify.BlobPrefix)
+
+	case common.CommandSASURLBlob:
+		url, err := bh.GenerateSASURLForBlob(opts.SAS.Container, opts.SAS.Blob, opts.SAS.Policy)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("SAS URL %s", url)
+
+	case common.CommandSASURLContainer:
+		url, err := bh.GenerateSASURLForContainer(opts.SAS.Container, opts.SAS.Policy)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("SAS URL %s", url)
+
+	case common.CommandListBlobs:
+		return listBlobs(bh, opts.List)
+
+	case common.CommandListContainers:
+		return listContainers(bh, opts.Output)
+
+	case common.CommandCreateContainer:
+		return bh.CreateContainer(opts.Container)
+
+	case common.CommandDelete:
+		return bh.DeleteBlobs(opts.Delete.Container, opts.Delete.BlobPrefix, opts.Delete.Snapshots)
+
+	case common.CommandSync:
+		return bh.SyncFiles(opts.Sync.Local, opts.Sync.Container, opts.Sync.Sync)
+
+	case common.CommandCopy:
+		if opts.Copy.S3Source != "" || opts.Copy.S3Dest != "" {
+			return copyS3(bh, opts.Copy)
+		}
+
+		sourceHandler, err := accountBlobHandler(opts.Copy.SourceAccount, opts, bh)
+		if err != nil {
+			return err
+		}
+
+		destHandler, err := accountBlobHandler(opts.Copy.DestAccount, opts, bh)
+		if err != nil {
+			return err
+		}
+
+		return destHandler.CopyBlobs(sourceHandler, opts.Copy.Container, opts.Copy.BlobPrefix, opts.Copy.DestContainer)
+
+	default:
+		return fmt.Errorf("Unsure of command to execute")
+	}
+
+	return nil
+}
+
+// setUploadBlocks passes the block options to the handler.
+func setUploadBlocks(bh *Handler.BlobHandler, blocks blockOptions) error {
+	bh.SetUploadJournal(blocks.JournalDir, blocks.Resume)
+	return bh.SetUploadBlocks(blocks.BlockSize, blocks.BlockConcurrency, blocks.MemoryBudget)
+}
+
+// accountBlobHandler returns a BlobHandler for the account (eg source/dest for copy).
+// If the account isn't set then the default handler is used.
+func accountBlobHandler(account *common.Account, opts *blobOptions, defaultHandler *Handler.BlobHandler) (*Handler.BlobHandler, error) {
+	if account == nil {
+		return defaultHandler, nil
+	}
+
+	bh, err := Handler.NewBlobHandler(*account, opts.ConcurrentCount)
+	if err != nil {
+		return nil, err
+	}
+	bh.SetFilter(opts.Filter)
+	bh.SetDryRun(opts.DryRun)
+
+	return bh, setUploadBlocks(bh, opts.Blocks)
+}
+
+// copyS3 copies between S3 and the container, depending on which of source/dest is an S3 URI.
+func copyS3(bh *Handler.BlobHandler, opts copyOptions) error {
+	sh, err := Handler.NewS3Handler(opts.S3.AccessID, opts.S3.AccessSecret, opts.S3.Region, opts.S3.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	if opts.S3Source != "" {
+		bucket, prefix, err := Handler.ParseS3URI(opts.S3Source)
+		if err != nil {
+			return err
+		}
+
+		return bh.CopyFromS3(sh, bucket, prefix, opts.Container)
+	}
+
+	bucket, prefix, err := Handler.ParseS3URI(opts.S3Dest)
+	if err != nil {
+		return err
+	}
+
+	return bh.CopyToS3(sh, opts.Container, opts.BlobPrefix, bucket, prefix)
+}
+
+// runWithSASURL uploads or downloads using only the container or blob SAS URL, no account credentials.
+// For a blob SAS URL the single blob is uploaded/downloaded, for a container SAS URL it's the same as the normal commands.
+func runWithSASURL(opts *blobOptions) error {
+	bh, containerName, blobName, err := Handler.NewBlobHandlerFromSASURL(opts.SASURL, opts.ConcurrentCount)
+	if err != nil {
+		return err
+	}
+	bh.SetMaxResults(opts.MaxResults)
+	bh.SetFilter(opts.Filter)
+	bh.SetDryRun(opts.DryRun)
+	bh.SetOverwrite(opts.Overwrite)
+	bh.SetContentSettings(opts.Content)
+
+	switch opts.Command {
+	case common.CommandUpload:
+		if err := setUploadBlocks(bh, opts.Blocks); err != nil {
+			return err
+		}
+
+		if blobName != "" {
+			return bh.UploadFileToBlob(opts.Upload.Local, containerName, blobName)
+		}
+		return bh.UploadFiles(opts.Upload.Local, containerName)
+
+	case common.CommandDownload:
+		if blobName != "" {
+			return bh.DownloadBlob(containerName, blobName, opts.Download.Local)
+		}
+		return bh.DownloadFiles(containerName, opts.Download.BlobPrefix, opts.Download.Local)
+	}
+
+	return fmt.Errorf("Only upload and download can be used with -sasurl")
+}
@@ -0,0 +1,474 @@
+package Command
+
+import (
+	"azurestoragetools/blob/Handler"
+	"azurestoragetools/common"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockOptions control how uploads are split into blocks.
+type blockOptions struct {
+	BlockSize        int64 // 0 means automatic
+	BlockConcurrency int
+	MemoryBudget     int64
+	JournalDir       string
+	Resume           bool
+}
+
+type uploadOptions struct {
+	Local     string
+	Container string
+}
+
+type downloadOptions struct {
+	Container  string
+	BlobPrefix string
+	Local      string
+}
+
+type listOptions struct {
+	Container  string
+	BlobPrefix string
+	Delimiter  string
+	Tree       bool
+	DiskUsage  bool
+	Output     string
+}
+
+type deleteOptions struct {
+	Container  string
+	BlobPrefix string
+	Snapshots  string
+}
+
+type syncOptions struct {
+	Local     string
+	Container string
+	Sync      Handler.SyncOptions
+}
+
+type copyOptions struct {
+	Container     string // source container (or destination when copying from S3)
+	BlobPrefix    string
+	DestContainer string
+
+	// set when copying to/from S3 instead of between Azure accounts.
+	S3Source string
+	S3Dest   string
+
+	S3 s3Options
+
+	// nil means the default account.
+	SourceAccount *common.Account
+	DestAccount   *common.Account
+}
+
+// s3Options are the S3 credentials for copying to/from S3.
+type s3Options struct {
+	AccessID     string
+	AccessSecret string
+	Region       string
+	Endpoint     string
+}
+
+type verifyOptions struct {
+	Local      string
+	Container  string
+	BlobPrefix string
+}
+
+type sasOptions struct {
+	Container string
+	Blob      string
+	Policy    common.SASPolicy
+}
+
+// blobOptions is the validated configuration for the command being run.
+// Only the options for that command are filled in.
+type blobOptions struct {
+	Command         int
+	ConcurrentCount int
+
+	// either the account or a container/blob SAS URL.
+	Account common.Account
+	SASURL  string
+
+	Blocks blockOptions
+
+	Upload     uploadOptions
+	Download   downloadOptions
+	Delete     deleteOptions
+	Sync       syncOptions
+	Copy       copyOptions
+	Verify     verifyOptions
+	SAS        sasOptions
+	List       listOptions
+	Container  string // createcontainer
+	Output     string // listcontainers
+	MaxResults int    // list, listcontainers, download and delete
+	Filter     Handler.Filter
+	DryRun     bool
+	Overwrite  string                  // upload and download
+	Content    Handler.ContentSettings // upload and sync
+}
+
+// validateOptions checks the configuration for the command and converts it into blobOptions.
+// Every problem found is reported in the returned error.
+func validateOptions(config *common.CloudConfig) (*blobOptions, error) {
+	problems := common.Problems{}
+	opts := blobOptions{Command: config.Command, ConcurrentCount: int(config.ConcurrentCount), DryRun: config.DryRun}
+	c := config.Configuration
+	name := commandNames[config.Command]
+
+	if config.ConcurrentCount > 1000 {
+		problems.Add("Maximum number for concurrent count is 1000")
+	}
+
+	opts.SASURL = c[common.SASURL]
+	if opts.SASURL != "" {
+		if config.Command != common.CommandUpload && config.Command != common.CommandDownload {
+			problems.Add("Only upload and download can be used with -sasurl")
+		}
+
+		if _, _, err := Handler.ParseSASURL(opts.SASURL); err != nil {
+			problems.AddErr(err)
+		}
+	} else {
+		account, err := common.AccountFromConfig(config)
+		problems.AddErr(err)
+		if err == nil {
+			problems.AddErr(account.CheckSASPermissions(commandPermissions[config.Command], name))
+		}
+		opts.Account = account
+	}
+
+	// container is part of the SAS URL.
+	container := c[common.Container]
+	if opts.SASURL == "" && config.Command != common.CommandListContainers {
+		problems.Required(container, "-container", name)
+	}
+
+	if c[common.MaxResults] != "" {
+		opts.MaxResults = problems.Int(c[common.MaxResults], "-maxresults", 1)
+	}
+
+	switch config.Command {
+	case common.CommandUpload:
+		opts.Upload = uploadOptions{Local: problems.Required(c[common.Local], "-local", name), Container: container}
+		opts.Blocks = validateBlockOptions(config, &problems)
+		opts.Filter = validateFilter(config, opts.Upload.Local, &problems)
+		opts.Overwrite = validateOverwrite(config, &problems)
+		opts.Content = validateContentSettings(config, &problems)
+
+	case common.CommandDownload:
+		opts.Download = downloadOptions{Container: container, BlobPrefix: c[common.BlobPrefix], Local: problems.Required(c[common.Local], "-local", name)}
+		opts.Filter = validateFilter(config, opts.Download.Local, &problems)
+		opts.Overwrite = validateOverwrite(config, &problems)
+
+	case common.CommandCreateContainer:
+		opts.Container = container
+
+	case common.CommandListBlobs:
+		opts.List = validateListOptions(config, container, &problems)
+		opts.Filter = validateFilter(config, "", &problems)
+
+	case common.CommandListContainers:
+		opts.Output = problems.OneOf(c[common.Output], "-output", common.OutputFormats...)
+
+	case common.CommandDelete:
+		opts.Delete = deleteOptions{
+			Container:  container,
+			BlobPrefix: problems.Required(c[common.BlobPrefix], "-blobprefix (either a blob name or prefix)", name),
+			Snapshots:  problems.OneOf(c[common.DeleteSnapshots], "-deletesnapshots", common.DeleteSnapshotsNone, common.DeleteSnapshotsInclude, common.DeleteSnapshotsOnly),
+		}
+		opts.Filter = validateFilter(config, "", &problems)
+
+	case common.CommandSync:
+		opts.Sync = syncOptions{
+			Local:     problems.Required(c[common.Local], "-local", name),
+			Container: container,
+			Sync: Handler.SyncOptions{
+				Direction: problems.OneOf(c[common.SyncDirection], "-direction", common.SyncUp, common.SyncDown),
+				Mirror:    config.Mirror,
+				CheckMD5:  config.CheckMD5,
+			},
+		}
+		opts.Blocks = validateBlockOptions(config, &problems)
+		opts.Content = validateContentSettings(config, &problems)
+
+	case common.CommandCopy:
+		opts.Copy = validateCopyOptions(config, opts.Account, &problems)
+		opts.Filter = validateFilter(config, "", &problems)
+		opts.Blocks = validateBlockOptions(config, &problems)
+		opts.Content = validateContentSettings(config, &problems)
+
+	case common.CommandVerify:
+		opts.Verify = verifyOptions{Local: problems.Required(c[common.Local], "-local", name), Container: container, BlobPrefix: c[common.BlobPrefix]}
+		opts.Filter = validateFilter(config, opts.Verify.Local, &problems)
+
+	case common.CommandSASURLBlob:
+		opts.SAS = sasOptions{
+			Container: container,
+			Blob:      problems.Required(c[common.BlobPrefix], "-blobprefix (the blob name)", name),
+			Policy:    common.SASPolicyFromConfig(config, common.SASResourceBlob, &problems),
+		}
+
+	case common.CommandSASURLContainer:
+		opts.SAS = sasOptions{Container: container, Policy: common.SASPolicyFromConfig(config, common.SASResourceContainer, &problems)}
+	}
+
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+
+	return &opts, nil
+}
+
+// validateListOptions checks the list options. -tree and -du split on / unless another delimiter is given.
+func validateListOptions(config *common.CloudConfig, container string, problems *common.Problems) listOptions {
+	opts := listOptions{
+		Container:  container,
+		BlobPrefix: config.Configuration[common.BlobPrefix],
+		Delimiter:  config.Configuration[common.Delimiter],
+		Tree:       config.Tree,
+		DiskUsage:  config.DiskUsage,
+		Output:     problems.OneOf(config.Configuration[common.Output], "-output", common.OutputFormats...),
+	}
+
+	if opts.Tree && opts.DiskUsage {
+		problems.Add("Only one of -tree and -du can be given")
+	}
+
+	if opts.Tree && opts.Output != common.OutputText {
+		problems.Add("-tree can only be used with text output")
+	}
+
+	if (opts.Tree || opts.DiskUsage) && opts.Delimiter == "" {
+		opts.Delimiter = "/"
+	}
+
+	return opts
+}
+
+// validateOverwrite checks the overwrite policy for upload and download.
+func validateOverwrite(config *common.CloudConfig, problems *common.Problems) string {
+	return problems.OneOf(config.Configuration[common.Replace], "-overwrite",
+		common.OverwriteAlways, common.OverwriteNever, common.OverwriteIfNewer, common.OverwriteIfDifferent)
+}
+
+// validateContentSettings parses the profile's content rules and the override flags.
+func validateContentSettings(config *common.CloudConfig, problems *common.Problems) Handler.ContentSettings {
+	c := config.Configuration
+	settings := Handler.ContentSettings{
+		Overrides: Handler.ContentProperties{
+			ContentType:        c[common.ContentType],
+			CacheControl:       c[common.CacheControl],
+			ContentDisposition: c[common.ContentDisposition],
+		},
+	}
+
+	for _, rule := range config.ContentRules {
+		p, err := Handler.NewPattern(rule.Pattern)
+		if err != nil {
+			problems.Add("Content rule: %s", err)
+			continue
+		}
+
+		settings.Rules = append(settings.Rules, Handler.ContentRule{
+			Pattern: p,
+			Properties: Handler.ContentProperties{
+				ContentType:        rule.ContentType,
+				ContentEncoding:    rule.ContentEncoding,
+				CacheControl:       rule.CacheControl,
+				ContentDisposition: rule.ContentDisposition,
+			},
+		})
+	}
+
+	return settings
+}
+
+// validateFilter parses the include/exclude patterns and the size/time filters.
+// Patterns in .astignore in the local directory (if any) are also excluded.
+func validateFilter(config *common.CloudConfig, local string, problems *common.Problems) Handler.Filter {
+	c := config.Configuration
+	filter := Handler.Filter{}
+
+	for _, include := range common.SplitList(c[common.Include]) {
+		p, err := Handler.NewPattern(include)
+		problems.AddErr(err)
+		filter.Include = append(filter.Include, p)
+	}
+
+	for _, exclude := range common.SplitList(c[common.Exclude]) {
+		p, err := Handler.NewPattern(exclude)
+		problems.AddErr(err)
+		filter.Exclude = append(filter.Exclude, p)
+	}
+
+	if fi, err := os.Stat(local); err == nil && fi.IsDir() {
+		ignored, err := Handler.ReadIgnoreFile(filepath.Join(local, Handler.IgnoreFileName))
+		problems.AddErr(err)
+		filter.Exclude = append(filter.Exclude, ignored...)
+	}
+
+	if c[common.NewerThan] != "" {
+		newerThan, err := parseNewerThan(c[common.NewerThan], time.Now())
+		problems.AddErr(err)
+		filter.NewerThan = newerThan
+	}
+
+	filter.LargerThan = problems.Size(c[common.LargerThan], "-larger-than")
+	return filter
+}
+
+// parseNewerThan parses a date (2026-01-31 or RFC3339) or an age before now (eg 36h or 7d).
+func parseNewerThan(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid -newer-than %s, should be a date (eg 2026-01-31) or age (eg 36h, 7d)", value)
+}
+
+// validateBlockOptions parses the upload block options.
+func validateBlockOptions(config *common.CloudConfig, problems *common.Problems) blockOptions {
+	count := problems.Count()
+	opts := blockOptions{
+		BlockSize:        problems.Size(config.Configuration[common.BlockSize], "-blocksize"),
+		BlockConcurrency: problems.Int(config.Configuration[common.BlockConcurrency], "-blockcc", 1),
+		MemoryBudget:     problems.Size(config.Configuration[common.MemoryBudget], "-maxmemory"),
+		JournalDir:       config.Configuration[common.JournalDir],
+		Resume:           config.Resume,
+	}
+
+	if problems.Count() == count && opts.MemoryBudget < 1 {
+		problems.Add("-maxmemory must be at least 1 byte")
+	}
+
+	return opts
+}
+
+// validateCopyOptions works out if the copy is between Azure accounts or to/from S3.
+// account is the default account, used for the source/dest unless another is given.
+func validateCopyOptions(config *common.CloudConfig, account common.Account, problems *common.Problems) copyOptions {
+	c := config.Configuration
+	opts := copyOptions{
+		Container:     c[common.Container],
+		BlobPrefix:    c[common.BlobPrefix],
+		DestContainer: common.FirstSet(c[common.DestContainer], c[common.Container]),
+	}
+
+	if c[common.Source] != "" || c[common.Dest] != "" {
+		if c[common.Source] != "" && c[common.Dest] != "" {
+			problems.Add("copy takes either -source or -dest, not both")
+		}
+
+		for _, uri := range []string{c[common.Source], c[common.Dest]} {
+			if uri == "" {
+				continue
+			}
+
+			if _, _, err := Handler.ParseS3URI(uri); err != nil {
+				problems.AddErr(err)
+			}
+		}
+
+		opts.S3Source = c[common.Source]
+		opts.S3Dest = c[common.Dest]
+		if opts.S3Source != "" {
+			opts.S3 = validateS3Options(config, common.S3SourceAccessID, common.S3SourceAccessSecret, common.S3SourceRegion, problems)
+		} else {
+			opts.S3 = validateS3Options(config, common.S3DestAccessID, common.S3DestAccessSecret, common.S3DestRegion, problems)
+		}
+		return opts
+	}
+
+	opts.SourceAccount = copyAccount(config, common.AzureSourceAccountName, common.AzureSourceAccountKey, problems)
+	opts.DestAccount = copyAccount(config, common.AzureDestAccountName, common.AzureDestAccountKey, problems)
+
+	// without -destcontainer the blobs go to the same container name, which only makes sense in another account.
+	if opts.DestContainer == opts.Container && sameAccount(opts.SourceAccount, opts.DestAccount, account) {
+		problems.Add("copy would replace every blob with itself, give a different -destcontainer or -AzureDestAccountName")
+	}
+	return opts
+}
+
+// sameAccount checks if the copy source and dest (nil for the default account) are the same storage account.
+func sameAccount(source *common.Account, dest *common.Account, account common.Account) bool {
+	if source == nil {
+		source = &account
+	}
+
+	if dest == nil {
+		dest = &account
+	}
+
+	return source.Name == dest.Name && source.Endpoint == dest.Endpoint
+}
+
+// validateS3Options gets the S3 credentials from the given config keys (eg source/dest for copy).
+// If the access ID isn't set then the default S3 credentials are used.
+func validateS3Options(config *common.CloudConfig, accessIDKey string, accessSecretKey string, regionKey string, problems *common.Problems) s3Options {
+	c := config.Configuration
+	if c[accessIDKey] == "" {
+		accessIDKey = common.S3DefaultAccessID
+		accessSecretKey = common.S3DefaultAccessSecret
+	}
+
+	opts := s3Options{
+		AccessID:     c[accessIDKey],
+		AccessSecret: c[accessSecretKey],
+		Region:       common.FirstSet(c[regionKey], c[common.S3DefaultRegion]),
+		Endpoint:     c[common.S3Endpoint],
+	}
+
+	if opts.AccessID == "" || opts.AccessSecret == "" {
+		problems.Add("copy to/from S3 requires S3 credentials (-S3DefaultAccessID and -S3DefaultAccessSecret or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+
+	if opts.Region == "" {
+		problems.Add("copy to/from S3 requires a region (-S3DefaultRegion or AWS_REGION)")
+	}
+
+	return opts
+}
+
+// copyAccount returns the source/dest account for copy, nil if not given (the default account is used).
+func copyAccount(config *common.CloudConfig, accountNameKey string, accountKeyKey string, problems *common.Problems) *common.Account {
+	if config.Configuration[accountNameKey] == "" {
+		return nil
+	}
+
+	account, err := common.AccountFromConfigKeys(config, accountNameKey, accountKeyKey)
+	if err != nil {
+		problems.Add("%s: %s", accountNameKey, err)
+		return nil
+	}
+
+	return &account
+}
+
+// String is used for debug logging, without any credentials.
+func (o blobOptions) String() string {
+	return fmt.Sprintf("command %s account %s concurrency %d", commandNames[o.Command], o.Account.Name, o.ConcurrentCount)
+}
@@ -0,0 +1,151 @@
+package Command
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/blob/Handler"
+	"azurestoragetools/common"
+	"os"
+	"strconv"
+	"time"
+)
+
+// blobColumns has no access tier, the SDK's API version (2016-05-31) predates it and BlobProperties has no field for it.
+var blobColumns = []string{"name", "size", "contenttype", "lastmodified", "etag", "contentmd5", "blobtype", "leasestate", "leasestatus", "metadata"}
+
+// blobRow is a blob for the -output formats.
+type blobRow struct {
+	Name         string            `json:"name"`
+	Size         int64             `json:"size"`
+	ContentType  string            `json:"contentType"`
+	LastModified string            `json:"lastModified"`
+	ETag         string            `json:"etag"`
+	ContentMD5   string            `json:"contentMD5"`
+	BlobType     string            `json:"blobType"`
+	LeaseState   string            `json:"leaseState"`
+	LeaseStatus  string            `json:"leaseStatus"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+func newBlobRow(b storage.Blob) blobRow {
+	p := b.Properties
+	return blobRow{
+		Name:         b.Name,
+		Size:         p.ContentLength,
+		ContentType:  p.ContentType,
+		LastModified: time.Time(p.LastModified).UTC().Format(time.RFC3339),
+		ETag:         p.Etag,
+		ContentMD5:   p.ContentMD5,
+		BlobType:     string(p.BlobType),
+		LeaseState:   p.LeaseState,
+		LeaseStatus:  p.LeaseStatus,
+		Metadata:     b.Metadata,
+	}
+}
+
+func (r blobRow) Values() []string {
+	return []string{r.Name, strconv.FormatInt(r.Size, 10), r.ContentType, r.LastModified, r.ETag, r.ContentMD5, r.BlobType, r.LeaseState, r.LeaseStatus, common.FormatMetadata(r.Metadata)}
+}
+
+var containerColumns = []string{"name", "lastmodified", "etag", "leasestate", "leasestatus", "leaseduration", "metadata"}
+
+// containerRow is a container for the -output formats.
+type containerRow struct {
+	Name          string            `json:"name"`
+	LastModified  string            `json:"lastModified"`
+	ETag          string            `json:"etag"`
+	LeaseState    string            `json:"leaseState"`
+	LeaseStatus   string            `json:"leaseStatus"`
+	LeaseDuration string            `json:"leaseDuration,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+}
+
+func newContainerRow(c storage.Container) containerRow {
+	p := c.Properties
+
+	// containers have the RFC1123 string as returned by Azure.
+	lastModified := p.LastModified
+	if t, err := time.Parse(time.RFC1123, p.LastModified); err == nil {
+		lastModified = t.UTC().Format(time.RFC3339)
+	}
+
+	return containerRow{
+		Name:          c.Name,
+		LastModified:  lastModified,
+		ETag:          p.Etag,
+		LeaseState:    p.LeaseState,
+		LeaseStatus:   p.LeaseStatus,
+		LeaseDuration: p.LeaseDuration,
+		Metadata:      c.Metadata,
+	}
+}
+
+func (r containerRow) Values() []string {
+	return []string{r.Name, r.LastModified, r.ETag, r.LeaseState, r.LeaseStatus, r.LeaseDuration, common.FormatMetadata(r.Metadata)}
+}
+
+// prefixRow is a virtual directory when listing with a delimiter.
+type prefixRow struct {
+	Name   string `json:"name"`
+	Prefix bool   `json:"prefix"`
+}
+
+func (r prefixRow) Values() []string {
+	return []string{r.Name, "", "", "", "", "", "prefix", "", "", ""}
+}
+
+// listBlobs outputs the blobs in the container, as a flat list, tree or disk usage roll up.
+// The flat list is output as each page is listed.
+func listBlobs(bh *Handler.BlobHandler, opts listOptions) error {
+	if opts.Tree || opts.DiskUsage {
+		root := newBlobTree(opts.BlobPrefix)
+		err := bh.WalkBlobs(opts.Container, opts.BlobPrefix, "", func(item Handler.BlobListItem) error {
+			root.addBlob(item.Blob, opts.Delimiter)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if opts.Tree {
+			// the root is labelled with the container, eg temp/logs/
+			root.name = opts.Container + "/" + opts.BlobPrefix
+			root.print(os.Stdout)
+			return nil
+		}
+
+		out := common.NewOutputWriter(os.Stdout, opts.Output, diskUsageColumns)
+		for _, row := range diskUsageRows(root) {
+			if err := out.Write(row); err != nil {
+				return err
+			}
+		}
+		return out.Close()
+	}
+
+	out := common.NewOutputWriter(os.Stdout, opts.Output, blobColumns)
+	err := bh.WalkBlobs(opts.Container, opts.BlobPrefix, opts.Delimiter, func(item Handler.BlobListItem) error {
+		if item.Prefix != "" {
+			return out.Write(prefixRow{Name: item.Prefix, Prefix: true})
+		}
+		return out.Write(newBlobRow(item.Blob))
+	})
+
+	// whatever was listed is still output (eg a complete json array) before the error.
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// listContainers outputs the containers in the account as they are listed.
+func listContainers(bh *Handler.BlobHandler, format string) error {
+	out := common.NewOutputWriter(os.Stdout, format, containerColumns)
+	err := bh.WalkContainers(func(c storage.Container) error {
+		return out.Write(newContainerRow(c))
+	})
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
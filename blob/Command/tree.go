@@ -0,0 +1,135 @@
+package Command
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// blobTree is a virtual directory (or blob) built by splitting blob names on the delimiter.
+// size and count roll up everything below it.
+type blobTree struct {
+	name     string
+	blob     bool
+	size     int64
+	count    int
+	children map[string]*blobTree
+}
+
+func newBlobTree(name string) *blobTree {
+	return &blobTree{name: name, children: make(map[string]*blobTree)}
+}
+
+// addBlob adds the blob (below the root's prefix) to the tree.
+func (t *blobTree) addBlob(b storage.Blob, delimiter string) {
+	// SplitAfter keeps the delimiter on the directories, eg logs/ 2026/ a.log
+	parts := strings.SplitAfter(strings.TrimPrefix(b.Name, t.name), delimiter)
+	if parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	t.add(parts, b.Properties.ContentLength)
+}
+
+func (t *blobTree) add(parts []string, size int64) {
+	t.size += size
+	t.count++
+	if len(parts) == 0 {
+		return
+	}
+
+	child, ok := t.children[parts[0]]
+	if !ok {
+		child = newBlobTree(parts[0])
+		t.children[parts[0]] = child
+	}
+
+	if len(parts) == 1 {
+		child.blob = true
+		child.size += size
+		child.count++
+		return
+	}
+	child.add(parts[1:], size)
+}
+
+// sortedChildren are the children in name order.
+func (t *blobTree) sortedChildren() []*blobTree {
+	names := []string{}
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	children := []*blobTree{}
+	for _, name := range names {
+		children = append(children, t.children[name])
+	}
+	return children
+}
+
+// describe is the name along with the size (and count for directories).
+func (t *blobTree) describe() string {
+	if t.blob && len(t.children) == 0 {
+		return fmt.Sprintf("%s (%s)", t.name, common.FormatSize(t.size))
+	}
+	return fmt.Sprintf("%s (%d blobs, %s)", t.name, t.count, common.FormatSize(t.size))
+}
+
+// print renders the tree, eg
+//
+//	logs/ (3 blobs, 1.2K)
+//	├── 2026/ (2 blobs, 1.0K)
+//	│   ├── a.log (512)
+//	│   └── b.log (512)
+//	└── readme.txt (200)
+func (t *blobTree) print(w io.Writer) {
+	fmt.Fprintln(w, t.describe())
+	t.printChildren(w, "")
+}
+
+func (t *blobTree) printChildren(w io.Writer, indent string) {
+	children := t.sortedChildren()
+	for i, child := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		fmt.Fprintln(w, indent+branch+child.describe())
+		child.printChildren(w, indent+next)
+	}
+}
+
+var diskUsageColumns = []string{"prefix", "blobs", "size"}
+
+// diskUsageRow is the roll up of a virtual directory.
+type diskUsageRow struct {
+	Prefix string `json:"prefix"`
+	Blobs  int    `json:"blobs"`
+	Size   int64  `json:"size"`
+}
+
+func (r diskUsageRow) Values() []string {
+	return []string{r.Prefix, strconv.Itoa(r.Blobs), strconv.FormatInt(r.Size, 10)}
+}
+
+func (r diskUsageRow) Text() string {
+	return fmt.Sprintf("%8s %8d  %s", common.FormatSize(r.Size), r.Blobs, r.Prefix)
+}
+
+// diskUsageRows rolls up each virtual directory directly below the prefix, followed by the total
+// (which also includes blobs directly under the prefix). Like du -c -d 1
+func diskUsageRows(root *blobTree) []diskUsageRow {
+	rows := []diskUsageRow{}
+	for _, child := range root.sortedChildren() {
+		if len(child.children) > 0 {
+			rows = append(rows, diskUsageRow{Prefix: root.name + child.name, Blobs: child.count, Size: child.size})
+		}
+	}
+
+	return append(rows, diskUsageRow{Prefix: "total", Blobs: root.count, Size: root.size})
+}
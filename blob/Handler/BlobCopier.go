@@ -0,0 +1,152 @@
+package Handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// how long the source SAS is valid for. The copy happens asynchronously in Azure so this needs to
+	// cover the whole copy, not just starting it.
+	copySASDuration = 24 * 60 * 60
+
+	// how often copy status is checked.
+	copyPollInterval = 2 * time.Second
+
+	copyStatusPending = "pending"
+	copyStatusSuccess = "success"
+	copyStatusAborted = "aborted"
+)
+
+// CopyBlobs copies a single blob or every blob that starts with blobPrefix from sourceContainer in the source account
+// to destContainer in this (destination) account. Copy Blob is done server side by Azure, the source is
+// read via a SAS URL so the accounts can be different. Same rules as DownloadFiles, blobPrefix might be a
+// specific blob or just literally a prefix.
+func (bh BlobHandler) CopyBlobs(source *BlobHandler, sourceContainer string, blobPrefix string, destContainer string) error {
+	log.Debugf("CopyBlobs %s/%s to %s/%s", source.accountName, sourceContainer, bh.accountName, destContainer)
+
+	container := bh.blobStorageClient.GetContainerReference(destContainer)
+	doesExist, err := container.Exists()
+	if err != nil {
+		return err
+	}
+
+	if !doesExist {
+		return fmt.Errorf("Container %s doesn't exist", destContainer)
+	}
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		err := source.WalkBlobs(sourceContainer, blobPrefix, "", func(item BlobListItem) error {
+			exists, err := blobExists(container.GetBlobReference(item.Blob.Name))
+			if err != nil {
+				return err
+			}
+			plan.addExisting(exists, destContainer+"/"+item.Blob.Name, item.Blob.Properties.ContentLength)
+			return nil
+		})
+		plan.summary()
+		return err
+	}
+
+	summary := newTransferSummary()
+	copyChannel := make(chan string, 1000)
+	var wg sync.WaitGroup
+
+	bh.launchCopyGoRoutines(source, sourceContainer, destContainer, copyChannel, summary, &wg)
+
+	// blobs are copied as they are listed.
+	err = source.walkBlobNames(sourceContainer, blobPrefix, func(blobName string) {
+		copyChannel <- blobName
+	})
+
+	close(copyChannel)
+	wg.Wait()
+
+	fmt.Printf("Copied %d blobs, %d failed\n", len(summary.done), summary.failed.count())
+	if err != nil {
+		return err
+	}
+	return summary.failed.err("copy")
+}
+
+// launchCopyGoRoutines starts a number of Go Routines used for copying
+func (bh BlobHandler) launchCopyGoRoutines(source *BlobHandler, sourceContainer string, destContainer string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	log.Debugf("launching %d goroutines", bh.concurrentFactor)
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go bh.copyBlobFromChannel(source, sourceContainer, destContainer, copyChannel, summary, wg)
+	}
+}
+
+// copyBlobFromChannel reads blob names from channel and copies them.
+func (bh BlobHandler) copyBlobFromChannel(source *BlobHandler, sourceContainer string, destContainer string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	container := bh.blobStorageClient.GetContainerReference(destContainer)
+	for blobName := range copyChannel {
+		err := bh.copyBlob(source, sourceContainer, blobName, container.GetBlobReference(blobName))
+		if err != nil {
+			fmt.Printf("failed %s : %s\n", blobName, err)
+			summary.failed.add(blobName, err)
+			continue
+		}
+
+		fmt.Printf("copied %s\n", blobName)
+		summary.addDone(blobName)
+	}
+}
+
+// copyBlob starts the server side copy and waits for it to finish. A copy still pending after copyTimeout
+// (by then the source SAS has expired) is aborted and fails.
+func (bh BlobHandler) copyBlob(source *BlobHandler, sourceContainer string, blobName string, destBlob Blob) error {
+
+	sourceURL, err := source.readURLForBlob(sourceContainer, blobName, copySASDuration)
+	if err != nil {
+		return err
+	}
+
+	copyID, err := destBlob.StartCopy(sourceURL, nil)
+	if err != nil {
+		return err
+	}
+	log.Debugf("copy %s started, id %s", blobName, copyID)
+
+	deadline := time.Now().Add(bh.copyTimeout)
+	for {
+		if err := destBlob.GetProperties(nil); err != nil {
+			return err
+		}
+
+		// another copy to the same blob has replaced ours.
+		if destBlob.Properties().CopyID != copyID {
+			return fmt.Errorf("Copy %s was replaced by copy %s", copyID, destBlob.Properties().CopyID)
+		}
+
+		switch destBlob.Properties().CopyStatus {
+		case copyStatusSuccess:
+			return nil
+		case copyStatusPending:
+			log.Debugf("copy %s progress %s", blobName, destBlob.Properties().CopyProgress)
+			remaining := deadline.Sub(time.Now())
+			if remaining <= 0 {
+				if err := destBlob.AbortCopy(copyID, nil); err != nil {
+					return fmt.Errorf("Copy still pending after %s and couldn't be aborted: %s", bh.copyTimeout, err)
+				}
+				return fmt.Errorf("Copy still pending after %s, aborted at %s", bh.copyTimeout, destBlob.Properties().CopyProgress)
+			}
+
+			if remaining > copyPollInterval {
+				remaining = copyPollInterval
+			}
+			time.Sleep(remaining)
+		default:
+			return fmt.Errorf("Copy %s: %s", destBlob.Properties().CopyStatus, destBlob.Properties().CopyStatusDescription)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pendingBlob is a copy destination whose copy never finishes.
+type pendingBlob struct {
+	Blob
+	aborted string
+}
+
+func (b *pendingBlob) GetProperties(options *storage.GetBlobPropertiesOptions) error {
+	if err := b.Blob.GetProperties(options); err != nil {
+		return err
+	}
+	b.Properties().CopyStatus = copyStatusPending
+	return nil
+}
+
+func (b *pendingBlob) AbortCopy(copyID string, options *storage.AbortCopyOptions) error {
+	b.aborted = copyID
+	return nil
+}
+
+func TestCopyBlobTimeout(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.txt", []byte("aaa"))
+	bh.copyTimeout = 10 * time.Millisecond
+
+	dest := &pendingBlob{Blob: service.GetContainerReference(testContainer).GetBlobReference("copy.txt")}
+	err := bh.copyBlob(bh, testContainer, "a.txt", dest)
+	if err == nil || !strings.Contains(err.Error(), "aborted") {
+		t.Fatalf("expected the pending copy to be aborted, got %v", err)
+	}
+
+	if dest.aborted == "" || dest.aborted != dest.Properties().CopyID {
+		t.Errorf("got abort of copy %q, expected %q", dest.aborted, dest.Properties().CopyID)
+	}
+}
+
+func TestCopyBlobs(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "logs/a.txt", []byte("aaa"))
+	putBlob(t, service, "other.txt", []byte("b"))
+
+	if _, err := service.GetContainerReference("archive").CreateIfNotExists(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bh.CopyBlobs(bh, testContainer, "logs/", "archive"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := service.GetContainerReference("archive").ListBlobs(storage.ListBlobsParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Blobs) != 1 || resp.Blobs[0].Name != "logs/a.txt" {
+		t.Errorf("got %v in archive, expected just logs/a.txt", resp.Blobs)
+	}
+}
@@ -0,0 +1,92 @@
+package Handler
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DeleteBlobs deletes a single blob or every blob that starts with blobPrefix.
+// Same rules as DownloadFiles, blobPrefix might be a specific blob or just literally a prefix.
+// snapshots is one of the common.DeleteSnapshots* values.
+func (bh BlobHandler) DeleteBlobs(containerName string, blobPrefix string, snapshots string) error {
+	log.Debugf("DeleteBlobs %s %s", containerName, blobPrefix)
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		err := bh.WalkBlobs(containerName, blobPrefix, "", func(item BlobListItem) error {
+			plan.add(planDelete, containerName+"/"+item.Blob.Name, item.Blob.Properties.ContentLength)
+			return nil
+		})
+		plan.summary()
+		return err
+	}
+
+	// blobs are deleted as they are listed.
+	return bh.deleteBlobs(containerName, snapshots, func(deleteChannel chan<- string) error {
+		return bh.walkBlobNames(containerName, blobPrefix, func(blobName string) {
+			deleteChannel <- blobName
+		})
+	})
+}
+
+// deleteBlobList deletes the given blobs using concurrentFactor goroutines and prints a summary.
+func (bh BlobHandler) deleteBlobList(containerName string, blobList []string, snapshots string) error {
+	return bh.deleteBlobs(containerName, snapshots, func(deleteChannel chan<- string) error {
+		for _, blobName := range blobList {
+			deleteChannel <- blobName
+		}
+		return nil
+	})
+}
+
+// deleteBlobs deletes every blob name list sends, using concurrentFactor goroutines, and prints a summary.
+func (bh BlobHandler) deleteBlobs(containerName string, snapshots string, list func(deleteChannel chan<- string) error) error {
+
+	summary := newTransferSummary()
+	deleteChannel := make(chan string, 1000)
+	var wg sync.WaitGroup
+
+	bh.launchDeleteGoRoutines(containerName, snapshots, deleteChannel, summary, &wg)
+
+	err := list(deleteChannel)
+
+	close(deleteChannel)
+	wg.Wait()
+
+	fmt.Printf("Deleted %d blobs, %d failed\n", len(summary.done), summary.failed.count())
+	if err != nil {
+		return err
+	}
+	return summary.failed.err("delete")
+}
+
+// launchDeleteGoRoutines starts a number of Go Routines used for deleting
+func (bh BlobHandler) launchDeleteGoRoutines(containerName string, snapshots string, deleteChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	log.Debugf("launching %d goroutines", bh.concurrentFactor)
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go bh.deleteBlobFromChannel(containerName, snapshots, deleteChannel, summary, wg)
+	}
+}
+
+// deleteBlobFromChannel reads blob names from channel and deletes them from Azure.
+func (bh BlobHandler) deleteBlobFromChannel(containerName string, snapshots string, deleteChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	for blobName := range deleteChannel {
+		fmt.Printf("deleting %s\n", blobName)
+
+		err := bh.Delete(containerName, blobName, snapshots)
+		if err != nil {
+			log.Debugf("delete %s failed %s", blobName, err)
+			summary.failed.add(blobName, err)
+			continue
+		}
+
+		summary.addDone(blobName)
+	}
+}
@@ -2,104 +2,378 @@ package Handler
 
 import (
 	"azure-sdk-for-go/storage"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
+	"hash"
 	"io"
+	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+const (
+	// blobs larger than this are downloaded as multiple ranges.
+	rangeDownloadThreshold = 32 * 1024 * 1024
+
+	// size of each range.
+	rangeSize = 8 * 1024 * 1024
+
+	// number of ranges of a single blob downloaded at the same time.
+	rangeGoRoutines = 4
+)
+
 // DownloadFiles downloads blob to local filesystem (filePath)
 // blobPrefix might be a specific blob or just literally a prefix.
-// Firing off goroutine for eachdownload.
-// Will see how this goes, otherwise we'll just throttle to a certain limit?
+// Downloads are spread across concurrentFactor goroutines, same as uploads.
+// Returns once every blob has been attempted, with an error listing any blobs that failed.
 func (bh BlobHandler) DownloadFiles(containerName string, blobPrefix string, filePath string) error {
-	container := bh.blobStorageClient.GetContainerReference(containerName)
+	log.Debugf("DownloadFiles %s %s %s", containerName, blobPrefix, filePath)
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		container := bh.blobStorageClient.GetContainerReference(containerName)
+		err := bh.WalkBlobs(containerName, blobPrefix, "", func(item BlobListItem) error {
+			localName, err := generateLocalName(filePath, item.Blob.Name)
+			if err != nil {
+				return err
+			}
+
+			skip, err := bh.downloadSkipReason(container.GetBlobReference(item.Blob.Name), localName)
+			if err != nil {
+				return err
+			}
+
+			if skip != "" {
+				plan.add(planSkip, localName, item.Blob.Properties.ContentLength)
+				return nil
+			}
+			return planDownload(plan, filePath, item.Blob)
+		})
+		plan.summary()
+		return err
+	}
+
+	// blobs are downloaded as they are listed.
+	count := 0
+	skipped := &skippedFiles{}
+	failed, err := bh.downloadBlobs(containerName, filePath, skipped, func(downloadChannel chan<- string) error {
+		return bh.walkBlobNames(containerName, blobPrefix, func(blobName string) {
+			count++
+			downloadChannel <- blobName
+		})
+	})
+
+	fmt.Printf("Downloaded %d blobs, %d skipped, %d failed\n", count-skipped.total()-failed.count(), skipped.total(), failed.count())
+	if err != nil {
+		return err
+	}
+	return failed.err("download")
+}
+
+// downloadBlobList downloads the given blobs to filePath using concurrentFactor goroutines.
+func (bh BlobHandler) downloadBlobList(containerName string, filePath string, blobList []string) error {
+	failed, _ := bh.downloadBlobs(containerName, filePath, &skippedFiles{}, func(downloadChannel chan<- string) error {
+		for _, blobName := range blobList {
+			downloadChannel <- blobName
+		}
+		return nil
+	})
+
+	return failed.err("download")
+}
+
+// downloadBlobs downloads every blob name list sends, using concurrentFactor goroutines.
+// Returns the blobs that failed along with any error from list, skipped counts the blobs left alone because of the overwrite policy.
+func (bh BlobHandler) downloadBlobs(containerName string, filePath string, skipped *skippedFiles, list func(downloadChannel chan<- string) error) (*blobErrors, error) {
+
+	// channel to hold names of all blobs to download.
+	downloadChannel := make(chan string, 1000)
+	failed := newBlobErrors()
+	var wg sync.WaitGroup
+
+	bh.launchDownloadGoRoutines(containerName, filePath, downloadChannel, failed, skipped, &wg)
+
+	err := list(downloadChannel)
+
+	close(downloadChannel)
+	wg.Wait()
+
+	return failed, err
+}
+
+// launchDownloadGoRoutines starts a number of Go Routines used for downloading
+func (bh BlobHandler) launchDownloadGoRoutines(containerName string, filePath string, downloadChannel chan string, failed *blobErrors, skipped *skippedFiles, wg *sync.WaitGroup) {
+
+	log.Debugf("launching %d goroutines", bh.concurrentFactor)
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go bh.downloadBlobFromChannel(containerName, filePath, downloadChannel, failed, skipped, wg)
+	}
+}
 
-	blobList := bh.listBlobs(containerName, blobPrefix)
+// downloadBlobFromChannel reads blob names from channel and downloads them to the local filesystem.
+// Blobs are skipped if the overwrite policy says the local file should be left alone.
+func (bh BlobHandler) downloadBlobFromChannel(containerName string, filePath string, downloadChannel chan string, failed *blobErrors, skipped *skippedFiles, wg *sync.WaitGroup) {
 
-	fmt.Printf("Downloading %d blobs\n", len(blobList))
+	defer wg.Done()
 
-	for _, blobName := range blobList {
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	for blobName := range downloadChannel {
 		blob := container.GetBlobReference(blobName)
-		sr, err := blob.Get(nil)
+		localName, err := generateLocalName(filePath, blobName)
 		if err != nil {
-			log.Fatal(err)
-			return err
+			failed.add(blobName, err)
+			continue
 		}
-		defer sr.Close()
 
-		localName := generateLocalName(filePath, blobName)
+		skip, err := bh.downloadSkipReason(blob, localName)
+		if err == nil && skip != "" {
+			skipped.add(blobName, skip)
+			continue
+		}
 
-		// read it!
-		fmt.Printf("reading %s\n", blobName)
-		go bh.downloadFile(sr, localName)
-	}
+		if err == nil {
+			fmt.Printf("reading %s\n", blobName)
+			err = bh.downloadBlob(blob, localName)
+		}
 
-	return nil
+		if err != nil {
+			log.Debugf("download %s failed %s", blobName, err)
+			failed.add(blobName, err)
+		}
+	}
 }
 
-func (bh *BlobHandler) downloadFile(sr io.ReadCloser, filePath string) error {
+// downloadBlob reads the blob and writes it to filePath.
+// Large blobs are fetched as multiple ranges in parallel.
+func (bh BlobHandler) downloadBlob(blob Blob, filePath string) error {
+	if err := blob.GetProperties(nil); err != nil {
+		return err
+	}
 
-	dirPart := filepath.Dir(filePath)
-	os.MkdirAll(dirPart, 0700)
+	var err error
+	if blob.Properties().ContentLength > rangeDownloadThreshold {
+		err = bh.downloadBlobInRanges(blob, filePath)
+	} else {
+		err = bh.downloadWholeBlob(blob, filePath)
+	}
 
-	log.Debugf("downloading to file %s", filePath)
-	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
-		log.Fatalf("create file error %s", err)
 		return err
 	}
-	defer file.Close()
 
-	// 100k buffer... way too small?
-	buffer := make([]byte, 1024*100)
+	// local file gets the blob's last modified time, so sync can tell if either side changes later.
+	lastModified := time.Time(blob.Properties().LastModified)
+	return os.Chtimes(filePath, lastModified, lastModified)
+}
 
-	finishedProcessing := false
-	for finishedProcessing == false {
-		numBytesRead, err := sr.Read(buffer)
-		if err != nil {
-			finishedProcessing = true
+func (bh BlobHandler) downloadWholeBlob(blob Blob, filePath string) error {
+	sr, err := blob.Get(&storage.GetBlobOptions{IfMatch: blob.Properties().Etag})
+	if serr, ok := err.(storage.AzureStorageServiceError); ok && serr.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s changed during the download", blob.Name())
+	}
+
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	return bh.downloadFile(sr, filePath, blob.Properties().ContentMD5)
+}
+
+// downloadFile copies the stream to filePath.
+// If contentMD5 is given then the downloaded data is verified against it.
+func (bh BlobHandler) downloadFile(sr io.Reader, filePath string, contentMD5 string) error {
+
+	log.Debugf("downloading to file %s", filePath)
+	return writeLocalFile(filePath, func(file *os.File) error {
+		h := md5.New()
+
+		// 100k buffer... way too small?
+		buffer := make([]byte, 1024*100)
+		if _, err := io.CopyBuffer(io.MultiWriter(file, h), sr, buffer); err != nil {
+			return err
 		}
 
-		if numBytesRead <= 0 {
-			finishedProcessing = true
-			continue
+		return checkMD5(contentMD5, h)
+	})
+}
+
+// downloadBlobInRanges splits the blob into ranges and downloads rangeGoRoutines of them at a time.
+// Each range is written at its offset in a preallocated file. Every range is only read if the blob still has the
+// ETag it had when sized, so a blob replaced part way through fails rather than giving a file spliced from both.
+func (bh BlobHandler) downloadBlobInRanges(blob Blob, filePath string) error {
+
+	size := blob.Properties().ContentLength
+	etag := blob.Properties().Etag
+	log.Debugf("downloading %d bytes in ranges to file %s", size, filePath)
+
+	return writeLocalFile(filePath, func(file *os.File) error {
+		if err := file.Truncate(size); err != nil {
+			return err
 		}
 
-		_, err = file.Write(buffer[:numBytesRead])
-		if err != nil {
-			log.Fatal(err)
+		rangeChannel := make(chan storage.BlobRange, 100)
+		errorChannel := make(chan error, rangeGoRoutines)
+		var rangeWG sync.WaitGroup
+
+		for i := 0; i < rangeGoRoutines; i++ {
+			rangeWG.Add(1)
+			go func() {
+				defer rangeWG.Done()
+				failed := false
+				for r := range rangeChannel {
+					// once failed, just drain the channel so the ranges don't block.
+					if failed {
+						continue
+					}
+
+					if err := downloadRange(blob, r, etag, file); err != nil {
+						log.Debugf("range %d-%d of %s failed %s", r.Start, r.End, blob.Name(), err)
+						errorChannel <- err
+						failed = true
+					}
+				}
+			}()
+		}
+
+		for start := int64(0); start < size; start += rangeSize {
+			end := start + rangeSize - 1
+			if end >= size {
+				end = size - 1
+			}
+			rangeChannel <- storage.BlobRange{Start: uint64(start), End: uint64(end)}
+		}
+		close(rangeChannel)
+		rangeWG.Wait()
+		close(errorChannel)
+
+		// only need to report the first failure.
+		if err, failed := <-errorChannel; failed {
 			return err
 		}
 
-	}
-	return nil
+		if blob.Properties().ContentMD5 == "" {
+			return nil
+		}
+
+		// ranges arrive out of order, so have to read the file back to check the MD5.
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		h := md5.New()
+		if _, err := io.Copy(h, file); err != nil {
+			return err
+		}
+		return checkMD5(blob.Properties().ContentMD5, h)
+	})
 }
 
-// generateLocalFileName generates the complete path that a blob will be downloaded to.
-// filePath is basically the location that it will be downloaded... blobName needs to be appended.
-// But... blobName will need to be converted to the appropriate format for the OS.
-func generateLocalName(filePath string, blobName string) string {
-	return fmt.Sprintf("%s%s", filePath, filepath.FromSlash(blobName))
+// downloadRange reads a single range of the blob (if it still has etag) and writes it at the same offset in file.
+func downloadRange(blob Blob, r storage.BlobRange, etag string, file *os.File) error {
+	sr, err := blob.GetRange(&storage.GetBlobRangeOptions{Range: &r, GetBlobOptions: &storage.GetBlobOptions{IfMatch: etag}})
+	if serr, ok := err.(storage.AzureStorageServiceError); ok && serr.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%s changed during the download", blob.Name())
+	}
+
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	buffer := make([]byte, r.End-r.Start+1)
+	if _, err := io.ReadFull(sr, buffer); err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt(buffer, int64(r.Start))
+	return err
 }
 
-func (bh BlobHandler) listBlobs(containerName string, blobPrefix string) []string {
+// writeLocalFile creates a temporary file next to filePath, lets write fill it, then renames it into place.
+// This way an existing file is only ever replaced by a complete download.
+func writeLocalFile(filePath string, write func(file *os.File) error) error {
 
-	// get all the blobs in the container with the given prefix!
-	params := storage.ListBlobsParameters{Prefix: blobPrefix}
-	container := bh.blobStorageClient.GetContainerReference(containerName)
-	blobListResponse, err := container.ListBlobs(params)
+	dirPart := filepath.Dir(filePath)
+	if err := os.MkdirAll(dirPart, 0700); err != nil {
+		return err
+	}
+
+	file, err := createTempFile(dirPart, "."+filepath.Base(filePath)+".ast")
 	if err != nil {
-		log.Fatal("Error")
+		return fmt.Errorf("create file error %s", err)
+	}
+	tempName := file.Name()
+
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	// a replaced file keeps its permissions, same as writing over it would.
+	if fi, statErr := os.Stat(filePath); err == nil && statErr == nil {
+		err = os.Chmod(tempName, fi.Mode().Perm())
+	}
+
+	if err == nil {
+		err = os.Rename(tempName, filePath)
+	}
+
+	if err != nil {
+		os.Remove(tempName)
+		return err
 	}
 
-	blobList := []string{}
+	return nil
+}
+
+// checkMD5 compares the (base64 encoded) Content-MD5 of a blob with what was actually read.
+// Blobs without a Content-MD5 can't be checked.
+func checkMD5(contentMD5 string, h hash.Hash) error {
+	if contentMD5 == "" {
+		return nil
+	}
+
+	actual := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if actual != contentMD5 {
+		return fmt.Errorf("MD5 mismatch, blob has %s but downloaded data is %s", contentMD5, actual)
+	}
+
+	return nil
+}
+
+// createTempFile creates a new file in dir, named prefix followed by a random number. Unlike ioutil.TempFile
+// the file is created 0666 (less the umask), the same as any other new file, as it becomes the downloaded file.
+func createTempFile(dir string, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// generateLocalName generates the complete path that a blob will be downloaded to, the blob name
+// (converted to the OS's separators) under filePath. Blob names can contain .. so anything that
+// would end up outside filePath is an error.
+func generateLocalName(filePath string, blobName string) (string, error) {
+	localName := filepath.Join(filePath, filepath.FromSlash(blobName))
 
-	for _, blob := range blobListResponse.Blobs {
-		blobList = append(blobList, blob.Name)
+	rel, err := filepath.Rel(filepath.Clean(filePath), localName)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("blob %s would be written outside %s", blobName, filePath)
 	}
 
-	return blobList
+	return localName, nil
 }
@@ -0,0 +1,146 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// changingBlob replaces the blob just before its content is first read.
+type changingBlob struct {
+	Blob
+	once    sync.Once
+	replace func()
+}
+
+func (b *changingBlob) GetRange(options *storage.GetBlobRangeOptions) (io.ReadCloser, error) {
+	b.once.Do(b.replace)
+	return b.Blob.GetRange(options)
+}
+
+func (b *changingBlob) Get(options *storage.GetBlobOptions) (io.ReadCloser, error) {
+	b.once.Do(b.replace)
+	return b.Blob.Get(options)
+}
+
+func TestDownloadWholeBlobReplaced(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	putBlob(t, service, "small.txt", []byte("before"))
+
+	blob := &changingBlob{
+		Blob:    service.GetContainerReference(testContainer).GetBlobReference("small.txt"),
+		replace: func() { putBlob(t, service, "small.txt", []byte("after")) },
+	}
+
+	localFile := filepath.Join(dir, "small.txt")
+	err := bh.downloadBlob(blob, localFile)
+	if err == nil || !strings.Contains(err.Error(), "changed during the download") {
+		t.Fatalf("expected the download to fail as the blob changed, got %v", err)
+	}
+
+	if _, err := os.Stat(localFile); !os.IsNotExist(err) {
+		t.Errorf("expected no local file after the failed download, got %v", err)
+	}
+}
+
+func TestDownloadRangesBlobReplaced(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	size := rangeDownloadThreshold + rangeSize
+	putBlob(t, service, "big.bin", bytes.Repeat([]byte("a"), size))
+
+	blob := &changingBlob{
+		Blob:    service.GetContainerReference(testContainer).GetBlobReference("big.bin"),
+		replace: func() { putBlob(t, service, "big.bin", bytes.Repeat([]byte("b"), size)) },
+	}
+
+	localFile := filepath.Join(dir, "big.bin")
+	err := bh.downloadBlob(blob, localFile)
+	if err == nil || !strings.Contains(err.Error(), "changed during the download") {
+		t.Fatalf("expected the download to fail as the blob changed, got %v", err)
+	}
+
+	if _, err := os.Stat(localFile); !os.IsNotExist(err) {
+		t.Errorf("expected no local file after the failed download, got %v", err)
+	}
+}
+
+func TestGenerateLocalName(t *testing.T) {
+	tests := []struct {
+		filePath string
+		blobName string
+		expected string
+	}{
+		{"out", "a.txt", filepath.Join("out", "a.txt")},
+		{"out" + string(os.PathSeparator), "sub/a.txt", filepath.Join("out", "sub", "a.txt")},
+		{"out", "sub/../a.txt", filepath.Join("out", "a.txt")},
+		{"out", "../../x", ""},
+		{"out", "sub/../../x", ""},
+		{"out", "..", ""},
+	}
+
+	for _, test := range tests {
+		localName, err := generateLocalName(test.filePath, test.blobName)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s in %s: expected an error, got %s", test.blobName, test.filePath, localName)
+			}
+			continue
+		}
+
+		if err != nil || localName != test.expected {
+			t.Errorf("%s in %s: got %s (%v), expected %s", test.blobName, test.filePath, localName, err, test.expected)
+		}
+	}
+}
+
+func TestDownloadFileMode(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "new.txt", []byte("new"))
+	putBlob(t, service, "script.sh", []byte("#!/bin/sh"))
+
+	// what any other new file gets, 0666 less the umask.
+	probe := filepath.Join(dir, "probe")
+	file, err := os.OpenFile(probe, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	probeInfo, err := os.Stat(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := filepath.Join(dir, "local")
+	writeFiles(t, local, map[string]string{"script.sh": "old"})
+	if err := os.Chmod(filepath.Join(local, "script.sh"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bh.DownloadFiles(testContainer, "", local); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]os.FileMode{"new.txt": probeInfo.Mode().Perm(), "script.sh": 0750} {
+		fi, err := os.Stat(filepath.Join(local, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fi.Mode().Perm() != mode {
+			t.Errorf("%s: got mode %s, expected %s", name, fi.Mode().Perm(), mode)
+		}
+	}
+}
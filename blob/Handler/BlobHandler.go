@@ -2,6 +2,11 @@ package Handler
 
 import (
 	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -9,124 +14,223 @@ import (
 )
 
 // Can copy between local filesystem and Azure Blob Storage.
-// Doesn't go across different Azure accounts yet.
+// Copies across different Azure accounts use a BlobHandler per account.
 type BlobHandler struct {
 
 	// creds.
 	accountName       string
 	accountKey        string
+	sasToken          string // only set when there is no account key
 	concurrentFactor  int
-	blobStorageClient storage.BlobStorageClient
+	blobStorageClient BlobService
+
+	// upload journal, used to resume uploads.
+	journalDir string
+	resume     bool
+
+	// block size for uploads, 0 means pick based on file size.
+	blockSize int64
+
+	// blocks of a single file uploaded at the same time.
+	blockConcurrency int
+
+	// bytes of block buffers allowed in memory across all uploads.
+	memory *memoryBudget
+
+	// most items listed (blobs, containers), 0 is no limit.
+	maxResults int
+
+	// which files/blobs to work on.
+	filter Filter
+
+	// only print what would be changed.
+	dryRun bool
+
+	// what uploads/downloads do when the destination exists, "" is always replace.
+	overwrite string
+
+	// how the content type etc of uploaded blobs is worked out.
+	content ContentSettings
+
+	// how long a server side copy can stay pending before it's aborted.
+	copyTimeout time.Duration
 }
 
-var wg sync.WaitGroup
+const (
+	// blocks of a single file uploaded at the same time.
+	defaultBlockConcurrency = 4
 
-// NewBlobHandler   create new instance of BlobHandler
-func NewBlobHandler(accountName string, accountKey string, concurrentFactor int) (*BlobHandler, error) {
-	bh := new(BlobHandler)
+	// bytes of block buffers allowed in memory across all uploads.
+	defaultMemoryBudget = 256 * 1024 * 1024
+)
 
-	client, err := storage.NewBasicClient(accountName, accountKey)
+// transferSummary keeps track of which blobs were processed (or not) across multiple goroutines.
+type transferSummary struct {
+	lock   sync.Mutex
+	done   []string
+	failed *blobErrors
+}
 
-	if err != nil {
-		return nil, err
-	}
+func newTransferSummary() *transferSummary {
+	return &transferSummary{failed: newBlobErrors()}
+}
 
-	bh.concurrentFactor = concurrentFactor
-	bh.accountName = accountName
-	bh.accountKey = accountKey
-	bh.blobStorageClient = client.GetBlobService()
-	return bh, nil
+func (ts *transferSummary) addDone(blobName string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.done = append(ts.done, blobName)
 }
 
-// Delete a blob
-func (bh BlobHandler) Delete(containerName string, blobName string) error {
-	return nil
+// blobErrors collects the errors for individual blobs across multiple goroutines.
+type blobErrors struct {
+	lock sync.Mutex
+	errs map[string]error
 }
 
-// GenerateSASURLForBlob generates SAS URL for blob
-func (bh BlobHandler) GenerateSASURLForBlob(containerName string, blobName string, durationInSeconds int, permissions string) (string, error) {
-	container := bh.blobStorageClient.GetContainerReference(containerName)
-	blob := container.GetBlobReference(blobName)
+func newBlobErrors() *blobErrors {
+	return &blobErrors{errs: make(map[string]error)}
+}
+
+func (be *blobErrors) add(blobName string, err error) {
+	be.lock.Lock()
+	defer be.lock.Unlock()
+	be.errs[blobName] = err
+}
+
+func (be *blobErrors) count() int {
+	be.lock.Lock()
+	defer be.lock.Unlock()
+	return len(be.errs)
+}
 
-	//expiry := time.Now().UTC().Add(time.Second * time.Duration(durationInSeconds))
-	expiry := time.Now().UTC().Add(time.Hour)
+// err returns nil if nothing failed, otherwise a single error listing every failed blob (sorted by name).
+func (be *blobErrors) err(action string) error {
+	be.lock.Lock()
+	defer be.lock.Unlock()
+
+	if len(be.errs) == 0 {
+		return nil
+	}
+
+	blobNames := []string{}
+	for blobName := range be.errs {
+		blobNames = append(blobNames, blobName)
+	}
+	sort.Strings(blobNames)
+
+	lines := []string{}
+	for _, blobName := range blobNames {
+		lines = append(lines, fmt.Sprintf("%s: %s", blobName, be.errs[blobName]))
+	}
+
+	return fmt.Errorf("Unable to %s %d blobs\n%s", action, len(blobNames), strings.Join(lines, "\n"))
+}
+
+// NewBlobHandler   create new instance of BlobHandler
+// account can use either the account key or a SAS token.
+func NewBlobHandler(account common.Account, concurrentFactor int) (*BlobHandler, error) {
+	client, err := account.NewStorageClient()
 
-	log.Debugf("now %s", time.Now().UTC())
-	log.Debugf("expiry %s", expiry)
-	u, err := blob.GetSASURI(expiry, permissions)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return u, nil
+	bh := NewBlobHandlerWithService(account.Name, account.Key, concurrentFactor, azureBlobService{client: client.GetBlobService()})
+	bh.sasToken = account.SASToken
+	return bh, nil
 }
 
-// GenerateSASURLForContainer generates SAS URL for container
-// Doesn't exist yet in SDK!
-func (bh BlobHandler) GenerateSASURLForContainer(containerName string, durationInSeconds int) (string, error) {
-	return "", nil
+// NewBlobHandlerWithService create new instance of BlobHandler using the given BlobService.
+// eg MemoryBlobService to run without an Azure account.
+func NewBlobHandlerWithService(accountName string, accountKey string, concurrentFactor int, service BlobService) *BlobHandler {
+	bh := new(BlobHandler)
+
+	bh.concurrentFactor = concurrentFactor
+	bh.accountName = accountName
+	bh.accountKey = accountKey
+	bh.blobStorageClient = service
+	bh.journalDir = filepath.Join(common.ASTDir(), "journal")
+	bh.blockConcurrency = defaultBlockConcurrency
+	bh.memory = newMemoryBudget(defaultMemoryBudget)
+	bh.copyTimeout = copySASDuration * time.Second
+	return bh
 }
 
-// CreateContainer creates a new container
-func (bh BlobHandler) CreateContainer(containerName string) error {
-	container := bh.blobStorageClient.GetContainerReference(containerName)
+// SetUploadBlocks sets the block size (0 for automatic), how many blocks of a single file are uploaded
+// at once, and the memory budget for block buffers across all uploads.
+func (bh *BlobHandler) SetUploadBlocks(blockSize int64, blockConcurrency int, memoryBudget int64) error {
+	if blockSize > maxBlockSize {
+		return fmt.Errorf("Block size %d is larger than the maximum %d", blockSize, maxBlockSize)
+	}
 
-	_, err := container.CreateIfNotExists(nil)
-	if err != nil {
-		return err
+	if blockConcurrency < 1 {
+		return fmt.Errorf("Block concurrency must be at least 1")
 	}
+
+	if memoryBudget < 1 {
+		return fmt.Errorf("Memory budget must be at least 1 byte")
+	}
+
+	bh.blockSize = blockSize
+	bh.blockConcurrency = blockConcurrency
+	bh.memory = newMemoryBudget(memoryBudget)
 	return nil
 }
 
-// ListBlobsInContainer lists the blobs in a container
-func (bh BlobHandler) ListBlobsInContainer(containerName string) ([]storage.Blob, error) {
-	log.Debugf("ListBlobsInContainer %s", containerName)
-	container := bh.blobStorageClient.GetContainerReference(containerName)
-	seen := []storage.Blob{}
-	marker := ""
-	for {
-		resp, err := container.ListBlobs(storage.ListBlobsParameters{
-			MaxResults: 100,
-			Marker:     marker})
-
-		if err != nil {
-			return nil, err
-		}
+// SetUploadJournal sets where upload journals are kept and if uploads should resume from them.
+// An empty journalDir keeps the default (~/.ast/journal).
+func (bh *BlobHandler) SetUploadJournal(journalDir string, resume bool) {
+	if journalDir != "" {
+		bh.journalDir = journalDir
+	}
+	bh.resume = resume
+}
 
-		for _, v := range resp.Blobs {
-			seen = append(seen, v)
-		}
+// Delete a blob.
+// snapshots is one of the common.DeleteSnapshots* values. Blobs that have snapshots
+// can't be deleted unless the snapshots are included (or only the snapshots are deleted).
+func (bh BlobHandler) Delete(containerName string, blobName string, snapshots string) error {
+	log.Debugf("Delete %s %s snapshots: %s", containerName, blobName, snapshots)
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	blob := container.GetBlobReference(blobName)
 
-		marker = resp.NextMarker
-		if marker == "" || len(resp.Blobs) == 0 {
-			break
-		}
+	options := storage.DeleteBlobOptions{}
+	switch snapshots {
+	case common.DeleteSnapshotsInclude:
+		includeSnapshots := true
+		options.DeleteSnapshots = &includeSnapshots
+	case common.DeleteSnapshotsOnly:
+		includeSnapshots := false
+		options.DeleteSnapshots = &includeSnapshots
+	case common.DeleteSnapshotsNone:
+	default:
+		return fmt.Errorf("Unknown snapshot option %s", snapshots)
 	}
 
-	return seen, nil
+	return blob.Delete(&options)
 }
 
-// ListContainers lists the blobs in a container
-func (bh BlobHandler) ListContainers() ([]storage.Container, error) {
-	log.Debugf("ListContainers start")
+// CreateContainer creates a new container
+func (bh BlobHandler) CreateContainer(containerName string) error {
+	container := bh.blobStorageClient.GetContainerReference(containerName)
 
-	seen := []storage.Container{}
-	marker := ""
-	for {
-		containerResponse, err := bh.blobStorageClient.ListContainers(storage.ListContainersParameters{MaxResults: 100, Marker: marker})
+	if bh.dryRun {
+		exists, err := container.Exists()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		for _, v := range containerResponse.Containers {
-			seen = append(seen, v)
-		}
-
-		marker = containerResponse.NextMarker
-		if marker == "" || len(containerResponse.Containers) == 0 {
-			break
+		if exists {
+			fmt.Printf("Dry run, container %s already exists\n", containerName)
+			return nil
 		}
+		fmt.Printf("Dry run, would create container %s\n", containerName)
+		return nil
 	}
 
-	return seen, nil
+	_, err := container.CreateIfNotExists(nil)
+	if err != nil {
+		return err
+	}
+	return nil
 }
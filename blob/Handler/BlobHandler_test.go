@@ -0,0 +1,166 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// container every test works in.
+const testContainer = "test"
+
+// newTestHandler creates a BlobHandler backed by a MemoryBlobService with an empty test container.
+// Upload journals are kept under dir.
+func newTestHandler(t *testing.T, dir string) (*BlobHandler, *MemoryBlobService) {
+	service := NewMemoryBlobService()
+	if _, err := service.GetContainerReference(testContainer).CreateIfNotExists(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	bh := NewBlobHandlerWithService("account", "", 3, service)
+	bh.SetUploadJournal(filepath.Join(dir, "journal"), false)
+	return bh, service
+}
+
+// tempDir creates a directory for the test, the caller removes it.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "asttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeFiles creates the files (name using / to contents) under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFile returns the contents of the local file, failing the test if it can't be read.
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// putBlob creates the blob as a single block, without a Content-MD5 (like blobs uploaded by other tools).
+func putBlob(t *testing.T, service *MemoryBlobService, blobName string, data []byte) {
+	blob := service.GetContainerReference(testContainer).GetBlobReference(blobName)
+	if err := blob.PutBlock("block", data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := blob.PutBlockList([]storage.Block{{ID: "block", Status: storage.BlockStatusUncommitted}}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getBlob returns the blob's contents and properties.
+func getBlob(t *testing.T, service *MemoryBlobService, blobName string) (string, storage.BlobProperties) {
+	blob := service.GetContainerReference(testContainer).GetBlobReference(blobName)
+	sr, err := blob.Get(nil)
+	if err != nil {
+		t.Fatalf("get %s: %s", blobName, err)
+	}
+	defer sr.Close()
+
+	data, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), *blob.Properties()
+}
+
+// blobNames lists the blobs in the test container, sorted.
+func blobNames(t *testing.T, service *MemoryBlobService) []string {
+	resp, err := service.GetContainerReference(testContainer).ListBlobs(storage.ListBlobsParameters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, blob := range resp.Blobs {
+		names = append(names, blob.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// blockingService holds every blob's GetProperties until release is closed.
+type blockingService struct {
+	*MemoryBlobService
+	release chan struct{}
+}
+
+func (s blockingService) GetContainerReference(name string) Container {
+	return blockingContainer{Container: s.MemoryBlobService.GetContainerReference(name), release: s.release}
+}
+
+type blockingContainer struct {
+	Container
+	release chan struct{}
+}
+
+func (c blockingContainer) GetBlobReference(name string) Blob {
+	return blockingBlob{Blob: c.Container.GetBlobReference(name), release: c.release}
+}
+
+type blockingBlob struct {
+	Blob
+	release chan struct{}
+}
+
+func (b blockingBlob) GetProperties(options *storage.GetBlobPropertiesOptions) error {
+	<-b.release
+	return b.Blob.GetProperties(options)
+}
+
+// An operation only waits for its own goroutines, not those of another operation still running.
+func TestConcurrentOperations(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.txt", []byte("a"))
+
+	release := make(chan struct{})
+	blocked := NewBlobHandlerWithService("account", "", 3, blockingService{MemoryBlobService: service, release: release})
+	downloaded := make(chan error)
+	go func() {
+		downloaded <- blocked.downloadBlobList(testContainer, filepath.Join(dir, "down")+string(os.PathSeparator), []string{"a.txt"})
+	}()
+
+	writeFiles(t, filepath.Join(dir, "up"), map[string]string{"b.txt": "b"})
+	uploaded := make(chan error)
+	go func() {
+		uploaded <- bh.UploadFiles(filepath.Join(dir, "up")+string(os.PathSeparator), testContainer)
+	}()
+
+	select {
+	case err := <-uploaded:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("upload waited for the blocked download")
+	}
+
+	close(release)
+	if err := <-downloaded; err != nil {
+		t.Error(err)
+	}
+}
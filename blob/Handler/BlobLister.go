@@ -0,0 +1,138 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// largest page Azure returns for a single list call.
+const maxListPageSize = 5000
+
+// BlobListItem is a blob or, when listing with a delimiter, a virtual directory (Prefix is set).
+type BlobListItem struct {
+	Blob   storage.Blob
+	Prefix string
+}
+
+// Name is the blob name or the virtual directory.
+func (item BlobListItem) Name() string {
+	if item.Prefix != "" {
+		return item.Prefix
+	}
+	return item.Blob.Name
+}
+
+// SetMaxResults caps the number of items listed (blobs, containers) for every command. 0 is no limit.
+func (bh *BlobHandler) SetMaxResults(maxResults int) {
+	bh.maxResults = maxResults
+}
+
+// pageSize is how many items to ask for in the next page, given how many have been listed so far.
+func (bh BlobHandler) pageSize(listed int) uint {
+	if bh.maxResults > 0 && bh.maxResults-listed < maxListPageSize {
+		return uint(bh.maxResults - listed)
+	}
+	return maxListPageSize
+}
+
+// WalkBlobs lists the blobs (with metadata) starting with prefix a page at a time, calling fn for each as soon as
+// its page arrives so nothing is accumulated in memory. If delimiter is given then blobs below the next delimiter
+// are grouped into virtual directories. Items are in name order. Listing stops at the first error from fn.
+// Blobs not matching the filter are skipped (and don't count towards the maximum results).
+func (bh BlobHandler) WalkBlobs(containerName string, prefix string, delimiter string, fn func(item BlobListItem) error) error {
+	log.Debugf("WalkBlobs %s prefix %s delimiter %s max %d", containerName, prefix, delimiter, bh.maxResults)
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+
+	listed := 0
+	marker := ""
+	for {
+		resp, err := container.ListBlobs(storage.ListBlobsParameters{
+			Prefix:     prefix,
+			Delimiter:  delimiter,
+			MaxResults: bh.pageSize(listed),
+			Marker:     marker,
+			Include:    &storage.IncludeBlobDataset{Metadata: true}})
+
+		if err != nil {
+			return err
+		}
+
+		for _, item := range mergePage(resp) {
+			if item.Prefix == "" && !bh.filter.Match(item.Blob.Name, item.Blob.Properties.ContentLength, time.Time(item.Blob.Properties.LastModified)) {
+				continue
+			}
+
+			if err := fn(item); err != nil {
+				return err
+			}
+
+			listed++
+			if listed == bh.maxResults {
+				return nil
+			}
+		}
+
+		// a page can be empty (eg the service timed out) and still have more after it, only the marker says when it's done.
+		marker = resp.NextMarker
+		if marker == "" {
+			return nil
+		}
+	}
+}
+
+// mergePage puts the blobs and virtual directories of a page into name order. Pages themselves are in order.
+func mergePage(resp storage.BlobListResponse) []BlobListItem {
+	items := []BlobListItem{}
+	b, p := 0, 0
+	for b < len(resp.Blobs) || p < len(resp.BlobPrefixes) {
+		if p == len(resp.BlobPrefixes) || (b < len(resp.Blobs) && resp.Blobs[b].Name < resp.BlobPrefixes[p]) {
+			items = append(items, BlobListItem{Blob: resp.Blobs[b]})
+			b++
+			continue
+		}
+
+		items = append(items, BlobListItem{Prefix: resp.BlobPrefixes[p]})
+		p++
+	}
+	return items
+}
+
+// walkBlobNames is WalkBlobs for just the names of every blob starting with prefix.
+func (bh BlobHandler) walkBlobNames(containerName string, prefix string, fn func(blobName string)) error {
+	return bh.WalkBlobs(containerName, prefix, "", func(item BlobListItem) error {
+		fn(item.Blob.Name)
+		return nil
+	})
+}
+
+// WalkContainers lists the containers (with metadata) a page at a time, calling fn for each.
+func (bh BlobHandler) WalkContainers(fn func(container storage.Container) error) error {
+	log.Debugf("WalkContainers max %d", bh.maxResults)
+
+	listed := 0
+	marker := ""
+	for {
+		resp, err := bh.blobStorageClient.ListContainers(storage.ListContainersParameters{MaxResults: bh.pageSize(listed), Marker: marker, Include: "metadata"})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range resp.Containers {
+			if err := fn(c); err != nil {
+				return err
+			}
+
+			listed++
+			if listed == bh.maxResults {
+				return nil
+			}
+		}
+
+		marker = resp.NextMarker
+		if marker == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// emptyPageService returns an empty first page of blobs and containers that still has a marker,
+// which the service does when a listing times out before it finds anything.
+type emptyPageService struct {
+	*MemoryBlobService
+	marker string
+}
+
+func (s emptyPageService) GetContainerReference(name string) Container {
+	return emptyPageContainer{Container: s.MemoryBlobService.GetContainerReference(name), marker: s.marker}
+}
+
+func (s emptyPageService) ListContainers(params storage.ListContainersParameters) (*storage.ContainerListResponse, error) {
+	if params.Marker == "" {
+		return &storage.ContainerListResponse{NextMarker: s.marker}, nil
+	}
+	return s.MemoryBlobService.ListContainers(params)
+}
+
+type emptyPageContainer struct {
+	Container
+	marker string
+}
+
+func (c emptyPageContainer) ListBlobs(params storage.ListBlobsParameters) (storage.BlobListResponse, error) {
+	if params.Marker == "" {
+		return storage.BlobListResponse{NextMarker: c.marker}, nil
+	}
+	return c.Container.ListBlobs(params)
+}
+
+func TestWalkBlobsEmptyPage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	_, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.txt", []byte("a"))
+	putBlob(t, service, "b.txt", []byte("b"))
+
+	bh := NewBlobHandlerWithService("account", "", 3, emptyPageService{MemoryBlobService: service, marker: "a.txt"})
+	names := []string{}
+	if err := bh.walkBlobNames(testContainer, "", func(blobName string) { names = append(names, blobName) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"a.txt", "b.txt"}) {
+		t.Errorf("got blobs %v, expected [a.txt b.txt]", names)
+	}
+}
+
+func TestWalkContainersEmptyPage(t *testing.T) {
+	service := NewMemoryBlobService()
+	for _, name := range []string{"one", "two"} {
+		if _, err := service.GetContainerReference(name).CreateIfNotExists(nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bh := NewBlobHandlerWithService("account", "", 3, emptyPageService{MemoryBlobService: service, marker: "one"})
+	names := []string{}
+	err := bh.WalkContainers(func(container storage.Container) error {
+		names = append(names, container.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"one", "two"}) {
+		t.Errorf("got containers %v, expected [one two]", names)
+	}
+}
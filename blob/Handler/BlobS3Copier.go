@@ -0,0 +1,193 @@
+package Handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// CopyFromS3 copies every object in the bucket starting with prefix (and matching the filter) into the container.
+// Blob names are the object keys. Objects are streamed straight from S3 into blocks, nothing is staged locally.
+func (bh BlobHandler) CopyFromS3(sh *S3Handler, bucket string, prefix string, containerName string) error {
+	log.Debugf("CopyFromS3 s3://%s/%s to %s", bucket, prefix, containerName)
+
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	doesExist, err := container.Exists()
+	if err != nil {
+		return err
+	}
+
+	if !doesExist {
+		return fmt.Errorf("Container %s doesn't exist", containerName)
+	}
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		err := bh.walkFilteredObjects(sh, bucket, prefix, func(key string, size int64) error {
+			exists, err := blobExists(container.GetBlobReference(key))
+			if err != nil {
+				return err
+			}
+			plan.addExisting(exists, containerName+"/"+key, size)
+			return nil
+		})
+		plan.summary()
+		return err
+	}
+
+	summary := newTransferSummary()
+	copyChannel := make(chan string, 1000)
+	var wg sync.WaitGroup
+
+	bh.launchCopyFromS3GoRoutines(sh, bucket, containerName, copyChannel, summary, &wg)
+
+	// objects are copied as they are listed.
+	err = bh.walkFilteredObjects(sh, bucket, prefix, func(key string, size int64) error {
+		copyChannel <- key
+		return nil
+	})
+
+	close(copyChannel)
+	wg.Wait()
+
+	fmt.Printf("Copied %d objects, %d failed\n", len(summary.done), summary.failed.count())
+	if err != nil {
+		return err
+	}
+	return summary.failed.err("copy")
+}
+
+// walkFilteredObjects calls fn with the key and size of every object in the bucket starting with prefix that matches the filter.
+func (bh BlobHandler) walkFilteredObjects(sh *S3Handler, bucket string, prefix string, fn func(key string, size int64) error) error {
+	return sh.walkObjects(bucket, prefix, func(key string, size int64, modified time.Time) error {
+		if !bh.filter.Match(key, size, modified) {
+			log.Debugf("filtered %s", key)
+			return nil
+		}
+		return fn(key, size)
+	})
+}
+
+// launchCopyFromS3GoRoutines starts a number of Go Routines used for copying from S3
+func (bh BlobHandler) launchCopyFromS3GoRoutines(sh *S3Handler, bucket string, containerName string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	log.Debugf("launching %d goroutines", bh.concurrentFactor)
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go bh.copyFromS3FromChannel(sh, bucket, containerName, copyChannel, summary, wg)
+	}
+}
+
+// copyFromS3FromChannel reads object keys from channel and streams them into blobs.
+func (bh BlobHandler) copyFromS3FromChannel(sh *S3Handler, bucket string, containerName string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	for key := range copyChannel {
+		err := bh.copyObjectToBlob(sh, bucket, key, container.GetBlobReference(key))
+		if err != nil {
+			fmt.Printf("failed %s : %s\n", key, err)
+			summary.failed.add(key, err)
+			continue
+		}
+
+		fmt.Printf("copied %s\n", key)
+		summary.addDone(key)
+	}
+}
+
+func (bh BlobHandler) copyObjectToBlob(sh *S3Handler, bucket string, key string, blob Blob) error {
+	obj, err := sh.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	defer obj.Body.Close()
+
+	return bh.uploadStream(obj.Body, aws.Int64Value(obj.ContentLength), blob)
+}
+
+// CopyToS3 copies a single blob or every blob starting with blobPrefix (and matching the filter) into the bucket.
+// Object keys are keyPrefix followed by the blob name. Blobs are streamed straight into S3 multipart uploads.
+func (bh BlobHandler) CopyToS3(sh *S3Handler, containerName string, blobPrefix string, bucket string, keyPrefix string) error {
+	log.Debugf("CopyToS3 %s %s to s3://%s/%s", containerName, blobPrefix, bucket, keyPrefix)
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		err := bh.WalkBlobs(containerName, blobPrefix, "", func(item BlobListItem) error {
+			exists, err := sh.objectExists(bucket, keyPrefix+item.Blob.Name)
+			if err != nil {
+				return err
+			}
+			plan.addExisting(exists, "s3://"+bucket+"/"+keyPrefix+item.Blob.Name, item.Blob.Properties.ContentLength)
+			return nil
+		})
+		plan.summary()
+		return err
+	}
+
+	summary := newTransferSummary()
+	copyChannel := make(chan string, 1000)
+	var wg sync.WaitGroup
+
+	bh.launchCopyToS3GoRoutines(sh, containerName, bucket, keyPrefix, copyChannel, summary, &wg)
+
+	// blobs are copied as they are listed.
+	err := bh.walkBlobNames(containerName, blobPrefix, func(blobName string) {
+		copyChannel <- blobName
+	})
+
+	close(copyChannel)
+	wg.Wait()
+
+	fmt.Printf("Copied %d blobs, %d failed\n", len(summary.done), summary.failed.count())
+	if err != nil {
+		return err
+	}
+	return summary.failed.err("copy")
+}
+
+// launchCopyToS3GoRoutines starts a number of Go Routines used for copying to S3
+func (bh BlobHandler) launchCopyToS3GoRoutines(sh *S3Handler, containerName string, bucket string, keyPrefix string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	log.Debugf("launching %d goroutines", bh.concurrentFactor)
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go bh.copyToS3FromChannel(sh, containerName, bucket, keyPrefix, copyChannel, summary, wg)
+	}
+}
+
+// copyToS3FromChannel reads blob names from channel and streams them into S3 objects.
+func (bh BlobHandler) copyToS3FromChannel(sh *S3Handler, containerName string, bucket string, keyPrefix string, copyChannel chan string, summary *transferSummary, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	for blobName := range copyChannel {
+		err := bh.copyBlobToObject(sh, container.GetBlobReference(blobName), bucket, keyPrefix+blobName)
+		if err != nil {
+			fmt.Printf("failed %s : %s\n", blobName, err)
+			summary.failed.add(blobName, err)
+			continue
+		}
+
+		fmt.Printf("copied %s\n", blobName)
+		summary.addDone(blobName)
+	}
+}
+
+// copyBlobToObject streams the blob into the object, blockConcurrency parts at a time.
+func (bh BlobHandler) copyBlobToObject(sh *S3Handler, blob Blob, bucket string, key string) error {
+	sr, err := blob.Get(nil)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+
+	return sh.client.Upload(&s3manager.UploadInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: sr}, bh.blockConcurrency)
+}
@@ -0,0 +1,133 @@
+package Handler
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3Keys lists the keys in the bucket, in order.
+func s3Keys(t *testing.T, sh *S3Handler, bucket string) []string {
+	keys := []string{}
+	err := sh.walkObjects(bucket, "", func(key string, size int64, modified time.Time) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// getObject returns the content of the object.
+func getObject(t *testing.T, service *MemoryS3Service, bucket string, key string) string {
+	obj, err := service.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Body.Close()
+
+	data, err := ioutil.ReadAll(obj.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCopyFromS3(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	now := time.Now()
+	s3Service := NewMemoryS3Service()
+	s3Service.PutObject("bucket", "logs/a.log", []byte("aaa"), now)
+	s3Service.PutObject("bucket", "logs/b.txt", []byte("bb"), now)
+	s3Service.PutObject("bucket", "logs/old.log", []byte("old"), now.Add(-48*time.Hour))
+	s3Service.PutObject("bucket", "other.log", []byte("other"), now)
+
+	include, err := NewPattern("*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh.SetFilter(Filter{Include: []Pattern{include}, NewerThan: now.Add(-24 * time.Hour)})
+
+	if err := bh.CopyFromS3(NewS3HandlerWithService(s3Service), "bucket", "logs/", testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := blobNames(t, service); !reflect.DeepEqual(names, []string{"logs/a.log"}) {
+		t.Fatalf("got blobs %v, expected [logs/a.log]", names)
+	}
+
+	if data, _ := getBlob(t, service, "logs/a.log"); data != "aaa" {
+		t.Errorf("got %q for logs/a.log, expected aaa", data)
+	}
+}
+
+func TestCopyToS3(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.log", []byte("aaa"))
+	putBlob(t, service, "b.txt", []byte("b"))
+	putBlob(t, service, "sub/c.log", []byte("c"))
+
+	exclude, err := NewPattern("*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh.SetFilter(Filter{Exclude: []Pattern{exclude}})
+
+	s3Service := NewMemoryS3Service()
+	s3Service.CreateBucket("bucket")
+	sh := NewS3HandlerWithService(s3Service)
+
+	if err := bh.CopyToS3(sh, testContainer, "", "bucket", "backup/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := s3Keys(t, sh, "bucket"); !reflect.DeepEqual(keys, []string{"backup/a.log", "backup/sub/c.log"}) {
+		t.Fatalf("got keys %v, expected [backup/a.log backup/sub/c.log]", keys)
+	}
+
+	if data := getObject(t, s3Service, "bucket", "backup/sub/c.log"); data != "c" {
+		t.Errorf("got %q for backup/sub/c.log, expected c", data)
+	}
+}
+
+func TestCopyToS3MissingBucket(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.log", []byte("aaa"))
+
+	if err := bh.CopyToS3(NewS3HandlerWithService(NewMemoryS3Service()), testContainer, "", "bucket", ""); err == nil {
+		t.Error("expected the copy to fail as the bucket doesn't exist")
+	}
+}
+
+func TestCopyToS3DryRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.log", []byte("aaa"))
+	bh.SetDryRun(true)
+
+	s3Service := NewMemoryS3Service()
+	s3Service.CreateBucket("bucket")
+	sh := NewS3HandlerWithService(s3Service)
+
+	if err := bh.CopyToS3(sh, testContainer, "", "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := s3Keys(t, sh, "bucket"); len(keys) != 0 {
+		t.Errorf("dry run copied %v", keys)
+	}
+}
@@ -0,0 +1,66 @@
+package Handler
+
+import (
+	"azurestoragetools/common"
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// GenerateSASURLForBlob generates SAS URL for blob
+func (bh BlobHandler) GenerateSASURLForBlob(containerName string, blobName string, policy common.SASPolicy) (string, error) {
+	log.Debugf("GenerateSASURLForBlob %s %s", containerName, blobName)
+
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	blob := container.GetBlobReference(blobName)
+
+	resource := fmt.Sprintf("/blob/%s/%s/%s", bh.accountName, containerName, blobName)
+	return bh.generateSASURL(blob.GetURL(), resource, policy)
+}
+
+// GenerateSASURLForContainer generates SAS URL for container
+// SDK doesn't provide container SAS, so everything is signed ourselves with the account key.
+func (bh BlobHandler) GenerateSASURLForContainer(containerName string, policy common.SASPolicy) (string, error) {
+	log.Debugf("GenerateSASURLForContainer %s", containerName)
+
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+
+	resource := fmt.Sprintf("/blob/%s/%s", bh.accountName, containerName)
+	return bh.generateSASURL(container.GetURL(), resource, policy)
+}
+
+func (bh BlobHandler) generateSASURL(resourceURL string, canonicalizedResource string, policy common.SASPolicy) (string, error) {
+	if bh.accountKey == "" {
+		return "", errors.New("Generating a SAS URL requires the account key, only a SAS token was given")
+	}
+
+	log.Debugf("start %s", policy.Start)
+	log.Debugf("expiry %s", policy.Expiry)
+
+	params, err := policy.Sign(bh.accountKey, canonicalizedResource)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s?%s", resourceURL, params.Encode()), nil
+}
+
+// readURLForBlob returns a URL that can read the blob without any other credentials (eg as the source of a copy).
+// Signed with the account key if we have it, otherwise the SAS token we were given is reused.
+// The URL is only limited to https if the account's endpoint is https, the emulator and http:// endpoints are plain http.
+func (bh BlobHandler) readURLForBlob(containerName string, blobName string, durationInSeconds int) (string, error) {
+	blob := bh.blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
+	if bh.accountKey == "" {
+		return fmt.Sprintf("%s?%s", blob.GetURL(), bh.sasToken), nil
+	}
+
+	httpsOnly := strings.HasPrefix(blob.GetURL(), "https://")
+	policy, err := common.NewSASPolicy(common.SASResourceBlob, durationInSeconds, "r", "", httpsOnly, "")
+	if err != nil {
+		return "", err
+	}
+
+	return bh.GenerateSASURLForBlob(containerName, blobName, *policy)
+}
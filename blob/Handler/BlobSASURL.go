@@ -0,0 +1,192 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// sasURLBlobService is the BlobService for a container (or blob) SAS URL.
+// There are no account credentials, so only the one container can be used.
+type sasURLBlobService struct {
+	container Container
+}
+
+func (s sasURLBlobService) GetContainerReference(name string) Container {
+	return s.container
+}
+
+func (s sasURLBlobService) ListContainers(params storage.ListContainersParameters) (*storage.ContainerListResponse, error) {
+	return nil, errors.New("Listing containers isn't possible with a SAS URL")
+}
+
+// sasURLContainer is a container from a SAS URL.
+type sasURLContainer struct {
+	azureContainer
+}
+
+// Exists is always true. Container/blob SAS can't read the container properties, if the container doesn't
+// exist the first blob operation fails instead.
+func (c sasURLContainer) Exists() (bool, error) {
+	return true, nil
+}
+
+// CreateIfNotExists can't create anything, see Exists.
+func (c sasURLContainer) CreateIfNotExists(options *storage.CreateContainerOptions) (bool, error) {
+	return false, nil
+}
+
+// ParseSASURL returns the container and blob names from a container or blob SAS URL.
+// Blob name is empty for container SAS URLs.
+func ParseSASURL(sasURL string) (string, string, error) {
+	u, err := url.Parse(sasURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.RawQuery == "" {
+		return "", "", fmt.Errorf("%s isn't a SAS URL, it has no token", sasURL)
+	}
+
+	path := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if path[0] == "" {
+		return "", "", fmt.Errorf("SAS URL %s doesn't include a container", sasURL)
+	}
+
+	if len(path) == 1 {
+		return path[0], "", nil
+	}
+
+	return path[0], path[1], nil
+}
+
+// NewBlobHandlerFromSASURL creates a BlobHandler that uses only the container or blob SAS URL (eg from GenerateSASURLForBlob),
+// no account credentials are needed. Returns the handler along with the container and blob names from the URL.
+func NewBlobHandlerFromSASURL(sasURL string, concurrentFactor int) (*BlobHandler, string, string, error) {
+	containerName, blobName, err := ParseSASURL(sasURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	u, err := url.Parse(sasURL)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	container, err := storage.GetContainerReferenceFromSASURI(*u)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	service := sasURLBlobService{container: sasURLContainer{azureContainer{container: container}}}
+	accountName := strings.SplitN(u.Host, ".", 2)[0]
+
+	bh := NewBlobHandlerWithService(accountName, "", concurrentFactor, service)
+	bh.sasToken = u.RawQuery
+	return bh, containerName, blobName, nil
+}
+
+// UploadFileToBlob uploads a single local file to the named blob (rather than a name based on the local path).
+func (bh BlobHandler) UploadFileToBlob(fileName string, containerName string, blobName string) error {
+	log.Debugf("UploadFileToBlob %s %s %s", fileName, containerName, blobName)
+
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory, only a single file can be uploaded to a blob", fileName)
+	}
+
+	blob := bh.blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
+	options, skip, err := bh.uploadConditions(fileName, blob)
+	if err != nil {
+		return err
+	}
+
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		if skip != "" {
+			plan.add(planSkip, containerName+"/"+blobName, fi.Size())
+		} else {
+			exists, err := blobExists(blob)
+			if err != nil {
+				return err
+			}
+			plan.addExisting(exists, containerName+"/"+blobName, fi.Size())
+		}
+		plan.summary()
+		return nil
+	}
+
+	if skip != "" {
+		fmt.Printf("skipping %s, %s\n", fileName, skip)
+		return nil
+	}
+
+	fmt.Printf("uploading %s\n", fileName)
+	err = bh.uploadFile(fileName, containerName, blob, options)
+	if err == errBlobChanged {
+		fmt.Printf("skipping %s, %s\n", fileName, err)
+		return nil
+	}
+	return err
+}
+
+// DownloadBlob downloads a single named blob without listing the container.
+// If filePath is a directory (or ends with a separator) the blob name is used for the local file name.
+func (bh BlobHandler) DownloadBlob(containerName string, blobName string, filePath string) error {
+	log.Debugf("DownloadBlob %s %s %s", containerName, blobName, filePath)
+
+	localName := filePath
+	fi, err := os.Stat(filePath)
+	if (err == nil && fi.IsDir()) || strings.HasSuffix(filePath, string(os.PathSeparator)) || strings.HasSuffix(filePath, "/") {
+		if localName, err = generateLocalName(filePath, blobName); err != nil {
+			return err
+		}
+	}
+
+	blob := bh.blobStorageClient.GetContainerReference(containerName).GetBlobReference(blobName)
+	skip, err := bh.downloadSkipReason(blob, localName)
+	if err != nil {
+		return err
+	}
+
+	if bh.dryRun {
+		if err := blob.GetProperties(nil); err != nil {
+			return err
+		}
+
+		plan := newDryRunPlan()
+		if skip != "" {
+			plan.add(planSkip, localName, blob.Properties().ContentLength)
+		} else {
+			exists, err := localFileExists(localName)
+			if err != nil {
+				return err
+			}
+			plan.addExisting(exists, localName, blob.Properties().ContentLength)
+		}
+		plan.summary()
+		return nil
+	}
+
+	if skip != "" {
+		fmt.Printf("skipping %s, %s\n", blobName, skip)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localName), 0700); err != nil {
+		return err
+	}
+
+	fmt.Printf("reading %s\n", blobName)
+	return bh.downloadBlob(blob, localName)
+}
@@ -0,0 +1,42 @@
+package Handler
+
+import (
+	"azurestoragetools/common"
+	"net/url"
+	"testing"
+)
+
+// The copy source URL can only be https-only if the account is reached over https.
+func TestReadURLForBlobProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint common.Endpoint
+		protocol string
+	}{
+		{"public cloud", common.DefaultEndpoint(), "https"},
+		{"emulator", common.Endpoint{Emulator: true}, "https,http"},
+		{"http endpoint", common.Endpoint{BaseURL: "mystorage.local"}, "https,http"},
+	}
+
+	for _, test := range tests {
+		account := common.NewAccount("myaccount", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4vMDEyMzQ1Njc4OTo7PD0+Pw==", "", test.endpoint)
+		bh, err := NewBlobHandler(account, 1)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		readURL, err := bh.readURLForBlob("mycontainer", "a.txt", 60)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		u, err := url.Parse(readURL)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if protocol := u.Query().Get("spr"); protocol != test.protocol {
+			t.Errorf("%s: got spr %s for %s, expected %s", test.name, protocol, readURL, test.protocol)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SyncOptions controls how SyncFiles compares and what it does with extra files.
+type SyncOptions struct {
+	// Direction is common.SyncUp (local to container) or common.SyncDown (container to local).
+	Direction string
+
+	// Mirror deletes anything at the destination that no longer exists at the source.
+	Mirror bool
+
+	// CheckMD5 compares content MD5 (when the blob has one) instead of trusting last modified times.
+	CheckMD5 bool
+}
+
+// SyncFiles makes the container match the local directory (or the other way around).
+// Only new or changed files are transferred. Files are compared by size, then MD5 (if CheckMD5) or last modified.
+func (bh BlobHandler) SyncFiles(filePath string, containerName string, options SyncOptions) error {
+	log.Debugf("SyncFiles %s %s %v", filePath, containerName, options)
+
+	// sync works on directories. Local files are matched up with blobs by their path relative to the cleaned root,
+	// the same form filepath.Walk gives, so ./dir or dir// compare the same as dir.
+	filePath = filepath.Clean(filePath)
+	if !strings.HasSuffix(filePath, string(os.PathSeparator)) {
+		filePath += string(os.PathSeparator)
+	}
+
+	blobs := make(map[string]storage.Blob)
+	err := bh.WalkBlobs(containerName, "", "", func(item BlobListItem) error {
+		blobs[item.Blob.Name] = item.Blob
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch options.Direction {
+	case common.SyncUp:
+		return bh.syncUp(filePath, containerName, blobs, options)
+	case common.SyncDown:
+		return bh.syncDown(filePath, containerName, blobs, options)
+	}
+
+	return fmt.Errorf("Unknown sync direction %s", options.Direction)
+}
+
+// syncUp uploads new/changed local files and (if mirroring) deletes blobs that don't exist locally.
+func (bh BlobHandler) syncUp(filePath string, containerName string, blobs map[string]storage.Blob, options SyncOptions) error {
+
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("Sync requires a local directory, %s isn't one", filePath)
+	}
+
+	localFiles, err := bh.getLocalFiles(filePath)
+	if err != nil {
+		return err
+	}
+
+	toUpload := []string{}
+	seen := make(map[string]bool)
+
+	for _, localFile := range localFiles {
+		blobName, err := relativeBlobName(filePath, localFile)
+		if err != nil {
+			// without every name, mirroring could delete blobs that do exist locally.
+			return fmt.Errorf("Unable to sync, no blob name for %s: %s", localFile, err)
+		}
+		seen[blobName] = true
+
+		blob, exists := blobs[blobName]
+		if exists {
+			changed, err := localFileChanged(localFile, blob, options.CheckMD5, true)
+			if err != nil {
+				return err
+			}
+
+			if !changed {
+				log.Debugf("unchanged %s", localFile)
+				continue
+			}
+		}
+
+		toUpload = append(toUpload, localFile)
+	}
+
+	toDelete := []string{}
+	if options.Mirror {
+		for blobName := range blobs {
+			if !seen[blobName] {
+				toDelete = append(toDelete, blobName)
+			}
+		}
+	}
+
+	fmt.Printf("Sync: %d to upload, %d unchanged, %d to delete\n", len(toUpload), len(localFiles)-len(toUpload), len(toDelete))
+
+	if bh.dryRun {
+		sort.Strings(toDelete)
+		plan := newDryRunPlan()
+		for _, localFile := range toUpload {
+			fi, err := os.Stat(localFile)
+			if err != nil {
+				return err
+			}
+
+			blobName, err := relativeBlobName(filePath, localFile)
+			if err != nil {
+				return err
+			}
+
+			_, exists := blobs[blobName]
+			plan.addExisting(exists, containerName+"/"+blobName, fi.Size())
+		}
+
+		for _, blobName := range toDelete {
+			plan.add(planDelete, containerName+"/"+blobName, blobs[blobName].Properties.ContentLength)
+		}
+		plan.summary()
+		return nil
+	}
+
+	if len(toUpload) > 0 {
+		if err := bh.uploadFileList(containerName, filePath, toUpload); err != nil {
+			return err
+		}
+	}
+
+	if len(toDelete) > 0 {
+		return bh.deleteBlobList(containerName, toDelete, common.DeleteSnapshotsInclude)
+	}
+
+	return nil
+}
+
+// syncDown downloads new/changed blobs and (if mirroring) deletes local files that don't exist in the container.
+func (bh BlobHandler) syncDown(filePath string, containerName string, blobs map[string]storage.Blob, options SyncOptions) error {
+
+	if !bh.dryRun {
+		if err := os.MkdirAll(filePath, 0700); err != nil {
+			return err
+		}
+	}
+
+	toDownload := []string{}
+	seen := make(map[string]bool)
+
+	for blobName, blob := range blobs {
+		localFile, err := generateLocalName(filePath, blobName)
+		if err != nil {
+			return fmt.Errorf("Unable to sync: %s", err)
+		}
+		seen[blobName] = true
+
+		if _, err := os.Stat(localFile); err == nil {
+			changed, err := localFileChanged(localFile, blob, options.CheckMD5, false)
+			if err != nil {
+				return err
+			}
+
+			if !changed {
+				log.Debugf("unchanged %s", blobName)
+				continue
+			}
+		}
+
+		toDownload = append(toDownload, blobName)
+	}
+
+	toDelete := []string{}
+
+	// a dry run doesn't create the directory, without one there's nothing to delete.
+	_, statErr := os.Stat(filePath)
+	if options.Mirror && !(bh.dryRun && os.IsNotExist(statErr)) {
+		localFiles, err := bh.getLocalFiles(filePath)
+		if err != nil {
+			return err
+		}
+
+		for _, localFile := range localFiles {
+			blobName, err := relativeBlobName(filePath, localFile)
+			if err != nil {
+				return fmt.Errorf("Unable to mirror, no blob name for %s: %s", localFile, err)
+			}
+
+			if !seen[blobName] {
+				toDelete = append(toDelete, localFile)
+			}
+		}
+	}
+
+	fmt.Printf("Sync: %d to download, %d unchanged, %d to delete\n", len(toDownload), len(blobs)-len(toDownload), len(toDelete))
+
+	if bh.dryRun {
+		sort.Strings(toDownload)
+		sort.Strings(toDelete)
+		plan := newDryRunPlan()
+		for _, blobName := range toDownload {
+			if err := planDownload(plan, filePath, blobs[blobName]); err != nil {
+				return err
+			}
+		}
+
+		for _, localFile := range toDelete {
+			fi, err := os.Stat(localFile)
+			if err != nil {
+				return err
+			}
+			plan.add(planDelete, localFile, fi.Size())
+		}
+		plan.summary()
+		return nil
+	}
+
+	if len(toDownload) > 0 {
+		if err := bh.downloadBlobList(containerName, filePath, toDownload); err != nil {
+			return err
+		}
+	}
+
+	for _, localFile := range toDelete {
+		fmt.Printf("deleting %s\n", localFile)
+		if err := os.Remove(localFile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localFileChanged compares the local file with the blob.
+// Different sizes always mean changed. Then if checkMD5 (and the blob has an MD5) the content decides,
+// otherwise the source being newer than the destination means changed.
+func localFileChanged(localFile string, blob storage.Blob, checkMD5 bool, localIsSource bool) (bool, error) {
+	fi, err := os.Stat(localFile)
+	if err != nil {
+		return false, err
+	}
+
+	if fi.Size() != blob.Properties.ContentLength {
+		return true, nil
+	}
+
+	if checkMD5 && blob.Properties.ContentMD5 != "" {
+		localMD5, err := localFileMD5(localFile)
+		if err != nil {
+			return false, err
+		}
+		return localMD5 != blob.Properties.ContentMD5, nil
+	}
+
+	// blob times only have second precision.
+	localModified := fi.ModTime().UTC().Truncate(time.Second)
+	blobModified := time.Time(blob.Properties.LastModified).UTC()
+
+	if localIsSource {
+		return localModified.After(blobModified), nil
+	}
+	return blobModified.After(localModified), nil
+}
+
+// localFileMD5 returns the base64 encoded MD5 of a local file, same format as Content-MD5.
+func localFileMD5(localFile string) (string, error) {
+	file, err := os.Open(localFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
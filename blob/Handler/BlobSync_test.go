@@ -0,0 +1,106 @@
+package Handler
+
+import (
+	"azurestoragetools/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// inParentDir changes to the parent of dir and returns dir as ./name, with a func to change back.
+func inParentDir(t *testing.T, dir string) (string, func()) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(filepath.Dir(dir)); err != nil {
+		t.Fatal(err)
+	}
+	return "./" + filepath.Base(dir), func() { os.Chdir(wd) }
+}
+
+func TestSyncUpMirrorDotSlash(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	bh, service := newTestHandler(t, dir)
+	local := filepath.Join(dir, "local")
+	writeFiles(t, local, map[string]string{"a.txt": "aaa", "sub/b.txt": "bbb"})
+
+	root, restore := inParentDir(t, local)
+	defer restore()
+
+	// every form of the same directory gives the same blob names, and re-syncing mirrors nothing away.
+	for _, filePath := range []string{root, root + "/", root + "//", local} {
+		if err := bh.SyncFiles(filePath, testContainer, SyncOptions{Direction: common.SyncUp, Mirror: true}); err != nil {
+			t.Fatalf("%s: %s", filePath, err)
+		}
+
+		if names := blobNames(t, service); !reflect.DeepEqual(names, []string{"a.txt", "sub/b.txt"}) {
+			t.Errorf("%s: got blobs %v, expected [a.txt sub/b.txt]", filePath, names)
+		}
+	}
+}
+
+func TestSyncDownMirrorDotSlash(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	bh, service := newTestHandler(t, dir)
+	putBlob(t, service, "a.txt", []byte("aaa"))
+	putBlob(t, service, "sub/b.txt", []byte("bbb"))
+
+	local := filepath.Join(dir, "local")
+	writeFiles(t, local, map[string]string{"stale.txt": "old"})
+
+	root, restore := inParentDir(t, local)
+	defer restore()
+
+	for _, filePath := range []string{root, root + "//", root} {
+		if err := bh.SyncFiles(filePath, testContainer, SyncOptions{Direction: common.SyncDown, Mirror: true}); err != nil {
+			t.Fatalf("%s: %s", filePath, err)
+		}
+
+		if got := readFile(t, filepath.Join(local, "a.txt")); got != "aaa" {
+			t.Errorf("%s: got a.txt %q, expected aaa", filePath, got)
+		}
+
+		if got := readFile(t, filepath.Join(local, "sub", "b.txt")); got != "bbb" {
+			t.Errorf("%s: got sub/b.txt %q, expected bbb", filePath, got)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(local, "stale.txt")); !os.IsNotExist(err) {
+		t.Errorf("stale.txt wasn't mirrored away: %v", err)
+	}
+}
+
+func TestRelativeBlobName(t *testing.T) {
+	tests := []struct {
+		root string
+		path string
+		name string
+	}{
+		{"dir", "dir/a.txt", "a.txt"},
+		{"./dir/", "dir/sub/a.txt", "sub/a.txt"},
+		{"dir//", "dir/a.txt", "a.txt"},
+		{"dir", "other/a.txt", ""},
+		{"dir", "dir", ""},
+	}
+
+	for _, test := range tests {
+		name, err := relativeBlobName(filepath.FromSlash(test.root), filepath.FromSlash(test.path))
+		if test.name == "" {
+			if err == nil {
+				t.Errorf("%s under %s: expected an error, got %s", test.path, test.root, name)
+			}
+			continue
+		}
+
+		if err != nil || name != test.name {
+			t.Errorf("%s under %s: got %q (%v), expected %s", test.path, test.root, name, err, test.name)
+		}
+	}
+}
@@ -2,13 +2,27 @@ package Handler
 
 import (
 	"azure-sdk-for-go/storage"
+	"bufio"
+	"bytes"
+	"crypto/md5"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/satori/uuid"
+)
+
+const (
+	// block size used when none is given and the file is small enough.
+	defaultBlockSize = 4 * 1024 * 1024
+
+	// service limits for block blobs.
+	maxBlockSize     = 100 * 1024 * 1024
+	maxBlocksPerBlob = 50000
 )
 
 // UploadFiles uploads file based off filepath.
@@ -26,35 +40,60 @@ func (bh BlobHandler) UploadFiles(filePath string, containerName string) error {
 		return fmt.Errorf("Container %s doesn't exist", containerName)
 	}
 
-	// channel to hold names of all local files to copy.
-	filesChannel := make(chan string, 1000)
+	allFiles, err := bh.getLocalFiles(filePath)
+	if err != nil {
+		return err
+	}
 
-	bh.launchUploadGoRoutines(containerName, filePath, filesChannel)
+	if bh.dryRun {
+		plan := newDryRunPlan()
+		err := bh.planUpload(plan, containerName, filePath, allFiles)
+		plan.summary()
+		return err
+	}
 
-	allFiles := bh.getLocalFiles(filePath)
 	fmt.Printf("Copying %d files\n", len(allFiles))
 
-	for _, file := range allFiles {
+	return bh.uploadFileList(containerName, filePath, allFiles)
+}
+
+// uploadFileList uploads the given local files (all under filePath) using concurrentFactor goroutines.
+func (bh BlobHandler) uploadFileList(containerName string, filePath string, fileList []string) error {
+
+	// channel to hold names of all local files to copy.
+	filesChannel := make(chan string, 1000)
+	failed := newBlobErrors()
+	skipped := &skippedFiles{}
+	var wg sync.WaitGroup
+
+	bh.launchUploadGoRoutines(containerName, filePath, filesChannel, failed, skipped, &wg)
+
+	for _, file := range fileList {
 		filesChannel <- file
 	}
 
 	close(filesChannel)
 	wg.Wait()
-	return nil
+
+	if skipped.total() > 0 {
+		fmt.Printf("Skipped %d files (overwrite %s)\n", skipped.total(), bh.overwrite)
+	}
+	return failed.err("upload")
 }
 
 // launchUploadGoRoutines starts a number of Go Routines used for uploading
-func (bh BlobHandler) launchUploadGoRoutines(containerName string, localFilePrefix string, copyChannel chan string) {
+func (bh BlobHandler) launchUploadGoRoutines(containerName string, localFilePrefix string, copyChannel chan string, failed *blobErrors, skipped *skippedFiles, wg *sync.WaitGroup) {
 
 	log.Debugf("launching %d goroutines", bh.concurrentFactor)
 	for i := 0; i < int(bh.concurrentFactor); i++ {
 		wg.Add(1)
-		go bh.uploadFileFromChannel(containerName, localFilePrefix, copyChannel)
+		go bh.uploadFileFromChannel(containerName, localFilePrefix, copyChannel, failed, skipped, wg)
 	}
 }
 
 // uploadFileFromChannel reads blob from channel and uploads to Azure.
-func (bh BlobHandler) uploadFileFromChannel(containerName string, localFilePrefix string, copyChannel chan string) {
+// Files are skipped if the overwrite policy says the blob should be left alone.
+func (bh BlobHandler) uploadFileFromChannel(containerName string, localFilePrefix string, copyChannel chan string, failed *blobErrors, skipped *skippedFiles, wg *sync.WaitGroup) {
 
 	defer wg.Done()
 
@@ -65,11 +104,14 @@ func (bh BlobHandler) uploadFileFromChannel(containerName string, localFilePrefi
 			// closed...   so all writing is done?  Or what?
 			return
 		}
-		fmt.Printf("uploading %s\n", fileName)
 
 		// calculate blob name
-		blobName := generateBlobName(fileName, localFilePrefix)
-		//blobName = "foo/kdkd"
+		blobName, err := generateBlobName(fileName, localFilePrefix)
+		if err != nil {
+			log.Debugf("naming %s failed %s", fileName, err)
+			failed.add(fileName, err)
+			continue
+		}
 
 		// get container. Should just be able to get once!
 		container := bh.blobStorageClient.GetContainerReference(containerName)
@@ -77,56 +119,339 @@ func (bh BlobHandler) uploadFileFromChannel(containerName string, localFilePrefi
 		// create blob
 		blob := container.GetBlobReference(blobName)
 
+		options, skip, err := bh.uploadConditions(fileName, blob)
+		if err != nil {
+			log.Debugf("checking %s failed %s", blobName, err)
+			failed.add(blobName, err)
+			continue
+		}
+
+		if skip != "" {
+			skipped.add(fileName, skip)
+			continue
+		}
+		fmt.Printf("uploading %s\n", fileName)
+
 		// upload file.
-		uploadFile(fileName, blob)
+		err = bh.uploadFile(fileName, containerName, blob, options)
+		if err == errBlobChanged {
+			skipped.add(fileName, err.Error())
+			continue
+		}
+
+		if err != nil {
+			log.Debugf("upload %s failed %s", fileName, err)
+			failed.add(blobName, err)
+		}
 	}
 
 }
 
-func uploadFile(fileName string, blob *storage.Blob) error {
+// blockToUpload is a single block of a local file or stream.
+// For streams the data has already been read, for files it's read when the block is uploaded.
+type blockToUpload struct {
+	blockID string
+	offset  int64
+	length  int64
+	data    []byte
+}
+
+// uploadFile puts the file as a series of blocks (blockConcurrency at a time) then commits the block list.
+// Block IDs are based on the offset within the file and every put block is recorded in a journal,
+// so if resuming, blocks that Azure already has (uncommitted) from a previous attempt are skipped.
+// options (if any) are the conditions for committing the block list, see uploadConditions.
+// The blob gets the MD5 of the whole file so downloads (and verify) can check it, along with its content type etc
+// (see ContentSettings).
+func (bh BlobHandler) uploadFile(fileName string, containerName string, blob Blob, options *storage.PutBlockListOptions) error {
 
 	log.Debugf("uploadFile %s", fileName)
 	// get stream to file.
 	file, err := os.OpenFile(fileName, os.O_RDONLY, 0)
 	if err != nil {
-		log.Errorf("Error %s", err)
 		return err
 	}
 	defer file.Close()
 
-	buffer := make([]byte, 1024*100)
-	numBytesRead := 0
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	blockSize, err := bh.calculateBlockSize(fi.Size())
+	if err != nil {
+		return err
+	}
+	log.Debugf("block size for %s is %d", fileName, blockSize)
+
+	contentProperties, err := bh.content.properties(blob.Name(), file)
+	if err != nil {
+		return err
+	}
+	log.Debugf("content properties for %s are %+v", fileName, contentProperties)
+
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	header := journalHeader{
+		LocalFile: absFileName,
+		Container: containerName,
+		BlobName:  blob.Name(),
+		Size:      fi.Size(),
+		ModTime:   fi.ModTime(),
+		BlockSize: blockSize,
+	}
+
+	journal, err := openUploadJournal(bh.journalDir, header, bh.resume)
+	if err != nil {
+		return err
+	}
+	defer journal.close()
+
+	existingBlocks := map[string]int64{}
+	if journal.resumed {
+		existingBlocks = getUncommittedBlocks(blob)
+	}
+
+	// whole file MD5 is worked out while the blocks upload, it's set on the blob with the block list.
+	var contentMD5 string
+	var md5Err error
+	md5Done := make(chan struct{})
+	go func() {
+		defer close(md5Done)
+		contentMD5, md5Err = localFileMD5(fileName)
+	}()
+
 	blockIDList := []string{}
-	finishedProcessing := false
-	for finishedProcessing == false {
-		numBytesRead, err = file.Read(buffer)
-		if err != nil {
-			finishedProcessing = true
-			continue
+	err = bh.putBlocks(blob, file, journal, func(blockChannel chan blockToUpload) error {
+		for offset := int64(0); offset < fi.Size(); offset += blockSize {
+			length := fi.Size() - offset
+			if length > blockSize {
+				length = blockSize
+			}
+
+			blockID := generateBlockID(offset)
+			blockIDList = append(blockIDList, blockID)
+
+			if size, ok := existingBlocks[blockID]; ok && size == length && journal.uploaded(offset) {
+				log.Debugf("block at offset %d already uploaded", offset)
+				continue
+			}
+
+			bh.memory.acquire(length)
+			blockChannel <- blockToUpload{blockID: blockID, offset: offset, length: length}
 		}
+		return nil
+	})
 
-		if numBytesRead <= 0 {
-			finishedProcessing = true
-			continue
-		}
-		blockID, err := writeMemoryToBlob(blob, buffer[:numBytesRead])
-		if err != nil {
-			log.Fatal("Unable to write memory to blob ", err)
+	<-md5Done
+	if err != nil {
+		return err
+	}
+
+	if md5Err != nil {
+		return md5Err
+	}
+	blob.Properties().ContentMD5 = contentMD5
+	setContentProperties(blob.Properties(), contentProperties)
+
+	if err := commitBlocks(blob, blockIDList, options); err != nil {
+		return err
+	}
+
+	return journal.remove()
+}
+
+// uploadStream reads size bytes from the stream and puts them to the blob as blocks, then commits the block list.
+// The stream is read sequentially but blocks are still uploaded blockConcurrency at a time.
+// The blob gets the MD5 of the whole stream, and the same content properties as an uploaded file (see ContentSettings).
+func (bh BlobHandler) uploadStream(sr io.Reader, size int64, blob Blob) error {
+
+	log.Debugf("uploadStream %s %d bytes", blob.Name(), size)
+	blockSize, err := bh.calculateBlockSize(size)
+	if err != nil {
+		return err
+	}
+
+	// same properties as a local file would get, sniffing from the start of the stream without consuming it.
+	br := bufio.NewReaderSize(sr, sniffLength)
+	start, err := br.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	contentProperties, err := bh.content.properties(blob.Name(), bytes.NewReader(start))
+	if err != nil {
+		return err
+	}
+	setContentProperties(blob.Properties(), contentProperties)
+	sr = br
+
+	// the stream is only read once, so the whole MD5 is worked out as the blocks are read.
+	h := md5.New()
+	blockIDList := []string{}
+	err = bh.putBlocks(blob, nil, nil, func(blockChannel chan blockToUpload) error {
+		for offset := int64(0); offset < size; offset += blockSize {
+			length := size - offset
+			if length > blockSize {
+				length = blockSize
+			}
+
+			bh.memory.acquire(length)
+			buffer := make([]byte, length)
+			if _, err := io.ReadFull(sr, buffer); err != nil {
+				bh.memory.release(length)
+				return err
+			}
+			h.Write(buffer)
+
+			blockID := generateBlockID(offset)
+			blockIDList = append(blockIDList, blockID)
+			blockChannel <- blockToUpload{blockID: blockID, offset: offset, length: length, data: buffer}
 		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	blob.Properties().ContentMD5 = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return commitBlocks(blob, blockIDList, nil)
+}
+
+// putBlocks uploads the blocks sent by produce using blockConcurrency goroutines.
+// produce has to acquire each block's length from the memory budget before sending it, the goroutines
+// release it once the block is done with. This bounds the memory in flight across all uploads.
+func (bh BlobHandler) putBlocks(blob Blob, file *os.File, journal *uploadJournal, produce func(blockChannel chan blockToUpload) error) error {
+
+	blockChannel := make(chan blockToUpload, bh.blockConcurrency)
+	errorChannel := make(chan error, bh.blockConcurrency)
+	var blockWG sync.WaitGroup
+
+	for i := 0; i < bh.blockConcurrency; i++ {
+		blockWG.Add(1)
+		go bh.uploadBlockFromChannel(file, blob, journal, blockChannel, errorChannel, &blockWG)
+	}
+
+	produceErr := produce(blockChannel)
+
+	close(blockChannel)
+	blockWG.Wait()
+	close(errorChannel)
 
-		blockIDList = append(blockIDList, blockID)
+	if produceErr != nil {
+		return produceErr
 	}
 
+	// only need to report the first failure.
+	if err, failed := <-errorChannel; failed {
+		return err
+	}
+
+	return nil
+}
+
+// commitBlocks puts the block list, which is what actually creates/replaces the blob.
+// If the put is conditional and the condition isn't met then errBlobChanged is returned.
+func commitBlocks(blob Blob, blockIDList []string, options *storage.PutBlockListOptions) error {
 	blockSlice := generateBlockSlice(blockIDList)
 
 	log.Debugf("blockslice is %v", blockSlice)
-	if err := blob.PutBlockList(blockSlice, nil); err != nil {
-		log.Fatalf("putBlockIDList failed %s", err)
+	if err := blob.PutBlockList(blockSlice, options); err != nil {
+		if options != nil && isConditionFailed(err) {
+			return errBlobChanged
+		}
+		return fmt.Errorf("putBlockIDList failed %s", err)
 	}
 
 	return nil
 }
 
+// uploadBlockFromChannel reads blocks from the channel and puts them to Azure.
+func (bh BlobHandler) uploadBlockFromChannel(file *os.File, blob Blob, journal *uploadJournal, blockChannel chan blockToUpload, errorChannel chan error, blockWG *sync.WaitGroup) {
+
+	defer blockWG.Done()
+
+	failed := false
+	for block := range blockChannel {
+		// once failed, just drain the channel so the blocks don't block.
+		if failed {
+			bh.memory.release(block.length)
+			continue
+		}
+
+		err := bh.uploadBlock(file, blob, journal, block)
+		bh.memory.release(block.length)
+
+		if err != nil {
+			log.Debugf("block at offset %d of %s failed %s", block.offset, blob.Name(), err)
+			errorChannel <- err
+			failed = true
+		}
+	}
+}
+
+// uploadBlock puts a single block, reading it from the file first if it isn't already in memory.
+func (bh BlobHandler) uploadBlock(file *os.File, blob Blob, journal *uploadJournal, block blockToUpload) error {
+	buffer := block.data
+	if buffer == nil {
+		buffer = make([]byte, block.length)
+		if _, err := file.ReadAt(buffer, block.offset); err != nil {
+			return err
+		}
+	}
+
+	if err := writeMemoryToBlob(blob, block.blockID, buffer); err != nil {
+		return err
+	}
+
+	if journal == nil {
+		return nil
+	}
+	return journal.record(block.offset)
+}
+
+// calculateBlockSize uses the block size given by the user or if none given picks one based on the file size.
+// A blob can have at most maxBlocksPerBlob blocks, each at most maxBlockSize.
+func (bh BlobHandler) calculateBlockSize(fileSize int64) (int64, error) {
+	if bh.blockSize > 0 {
+		if (fileSize+bh.blockSize-1)/bh.blockSize > maxBlocksPerBlob {
+			return 0, fmt.Errorf("File size %d needs more than %d blocks of %d bytes, increase blocksize", fileSize, maxBlocksPerBlob, bh.blockSize)
+		}
+		return bh.blockSize, nil
+	}
+
+	blockSize := int64(defaultBlockSize)
+	for (fileSize+blockSize-1)/blockSize > maxBlocksPerBlob {
+		blockSize *= 2
+	}
+
+	if blockSize > maxBlockSize {
+		return 0, fmt.Errorf("File size %d is too large for a block blob", fileSize)
+	}
+
+	return blockSize, nil
+}
+
+// getUncommittedBlocks returns the block IDs (and sizes) that have been put but not committed for the blob.
+// If the blob doesn't exist (or the list can't be read) then there is nothing to reuse.
+func getUncommittedBlocks(blob Blob) map[string]int64 {
+	blocks := map[string]int64{}
+
+	resp, err := blob.GetBlockList(storage.BlockListTypeUncommitted, nil)
+	if err != nil {
+		log.Debugf("unable to get uncommitted blocks for %s: %s", blob.Name(), err)
+		return blocks
+	}
+
+	for _, b := range resp.UncommittedBlocks {
+		blocks[b.Name] = b.Size
+	}
+	return blocks
+}
+
 func generateBlockSlice(blockIDList []string) []storage.Block {
 	blockSlice := []storage.Block{}
 	for _, block := range blockIDList {
@@ -138,69 +463,110 @@ func generateBlockSlice(blockIDList []string) []storage.Block {
 	return blockSlice
 }
 
-func writeMemoryToBlob(blob *storage.Blob, buffer []byte) (string, error) {
-
-	log.Debugf("writeMemoryToBlob buffer length %d", len(buffer))
-	blockID := fmt.Sprintf("%s", uuid.NewV4())
+// generateBlockID generates block ID from the offset of the block within the file.
+// Same file always gives the same IDs, which is what lets an upload be resumed.
+// All IDs for a blob have to be the same length, hence the padding.
+func generateBlockID(offset int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%020d", offset)))
+}
 
-	log.Debugf("1generate blockID is %s", blockID)
-	blockID = base64.StdEncoding.EncodeToString([]byte(blockID))
+// writeMemoryToBlob puts the block along with its MD5, so Azure rejects it if it's corrupted on the way.
+func writeMemoryToBlob(blob Blob, blockID string, buffer []byte) error {
 
-	log.Debugf("2generate blockID is %s", blockID)
-	err := blob.PutBlock(blockID, buffer, nil)
+	log.Debugf("writeMemoryToBlob buffer length %d", len(buffer))
+	log.Debugf("blockID is %s", blockID)
+	blockMD5 := md5.Sum(buffer)
+	err := blob.PutBlock(blockID, buffer, &storage.PutBlockOptions{ContentMD5: base64.StdEncoding.EncodeToString(blockMD5[:])})
 	if err != nil {
-		log.Fatalf("Unable to PutBlock %s, %s ", blockID, err)
+		return fmt.Errorf("Unable to PutBlock %s, %s ", blockID, err)
 	}
-	return blockID, nil
+	return nil
 }
 
 // generateBlobName  if localFilePrefix is a file, then just return the file portion of pathName
-// if localFilePrefix is a directory, then return the portion of pathName that doesn't include localFilePrefix
-func generateBlobName(pathName string, localFilePrefix string) string {
+// if localFilePrefix is a directory, then return pathName relative to it (see relativeBlobName)
+func generateBlobName(pathName string, localFilePrefix string) (string, error) {
 
 	file, err := os.OpenFile(localFilePrefix, os.O_RDONLY, 0)
 	if err != nil {
-		log.Fatalf("Error %s", err)
+		return "", err
 	}
 	defer file.Close()
 
 	fi, err := file.Stat()
 	if err != nil {
-		log.Fatalf("Error %s", err)
+		return "", err
 	}
 
 	// if directory, prune the sucker.
 	if !fi.IsDir() {
 		log.Debugf("name is %s", fi.Name())
-		return fi.Name()
+		return fi.Name(), nil
 	}
 
-	v := pathName[len(localFilePrefix):]
-	s := filepath.ToSlash(v)
+	s, err := relativeBlobName(localFilePrefix, pathName)
+	if err != nil {
+		return "", err
+	}
 	log.Debugf("pruned generated blob name is %s", s)
-	return s
+	return s, nil
+
+}
+
+// relativeBlobName is the blob name for a path under the local directory root, the path relative to root using /.
+// Both are cleaned first so ./dir, dir/ and dir// give the same names as the (cleaned) paths filepath.Walk returns.
+// Paths that aren't below root are an error.
+func relativeBlobName(root string, path string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.ToSlash(rel)
+	if name == "" || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%s isn't below %s", path, root)
+	}
 
+	return name, nil
 }
 
-// getLocalFiles gets the local files and puts the names on the filesChannel.
-func (bh BlobHandler) getLocalFiles(filePath string) []string {
+// getLocalFiles gets the local files under filePath (or just filePath if it's a file) that match the filter.
+// The filter is matched against the blob name each file is uploaded as. Any error walking the directory
+// (eg a subdirectory that can't be read) is returned, rather than carrying on without some of the files.
+func (bh BlobHandler) getLocalFiles(filePath string) ([]string, error) {
 
 	fileSlice := []string{}
 
 	err := filepath.Walk(filePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
 		if info.IsDir() {
 			return nil
 		}
 
+		// a single file is uploaded using its own name.
+		blobName := info.Name()
+		if path != filePath {
+			if blobName, err = relativeBlobName(filePath, path); err != nil {
+				return err
+			}
+		}
+
+		if !bh.filter.Match(blobName, info.Size(), info.ModTime()) {
+			log.Debugf("filtered %s", path)
+			return nil
+		}
+
 		log.Debugf("file %s", path)
 		fileSlice = append(fileSlice, path)
-		//filesChannel <- path
 		return nil
 	})
 
 	if err != nil {
-		log.Debugf("ERROR during walk %s", err)
+		return nil, fmt.Errorf("Unable to list the local files: %s", err)
 	}
 
-	return fileSlice
+	return fileSlice, nil
 }
@@ -0,0 +1,234 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"bytes"
+	"math/rand"
+	"mime"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUploadDownloadRoundTrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	files := map[string]string{"a.txt": "aaa", "sub/b.html": "<html></html>", "empty": ""}
+	writeFiles(t, filepath.Join(dir, "up"), files)
+
+	if err := bh.UploadFiles(filepath.Join(dir, "up")+string(os.PathSeparator), testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := blobNames(t, service); !reflect.DeepEqual(names, []string{"a.txt", "empty", "sub/b.html"}) {
+		t.Fatalf("got blobs %v, expected [a.txt empty sub/b.html]", names)
+	}
+
+	if _, props := getBlob(t, service, "sub/b.html"); props.ContentMD5 == "" || props.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("got MD5 %q and content type %q for sub/b.html", props.ContentMD5, props.ContentType)
+	}
+
+	down := filepath.Join(dir, "down") + string(os.PathSeparator)
+	if err := bh.DownloadFiles(testContainer, "", down); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		if got := readFile(t, filepath.Join(down, filepath.FromSlash(name))); got != contents {
+			t.Errorf("%s: got %q, expected %q", name, got, contents)
+		}
+	}
+
+	if err := bh.VerifyFiles(filepath.Join(dir, "up"), testContainer, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+// A file larger than rangeDownloadThreshold is uploaded in several blocks and downloaded in ranges.
+func TestUploadDownloadRoundTripRanged(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	if err := bh.SetUploadBlocks(4*1024*1024, 4, 64*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	// odd size so the last block and range are partial.
+	data := make([]byte, rangeDownloadThreshold+rangeSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	writeFiles(t, filepath.Join(dir, "up"), map[string]string{"big.bin": string(data)})
+
+	if err := bh.UploadFiles(filepath.Join(dir, "up", "big.bin"), testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := service.GetContainerReference(testContainer).GetBlobReference("big.bin").GetBlockList(storage.BlockListTypeCommitted, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks.CommittedBlocks) < 2 {
+		t.Errorf("expected several blocks, got %d", len(blocks.CommittedBlocks))
+	}
+
+	down := filepath.Join(dir, "down") + string(os.PathSeparator)
+	if err := bh.DownloadFiles(testContainer, "big.bin", down); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(down, "big.bin")); !bytes.Equal([]byte(got), data) {
+		t.Errorf("downloaded big.bin (%d bytes) doesn't match the uploaded data (%d bytes)", len(got), len(data))
+	}
+}
+
+func TestUploadOverwriteNever(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	local := filepath.Join(dir, "a.txt")
+	writeFiles(t, dir, map[string]string{"a.txt": "one"})
+	if err := bh.UploadFiles(local, testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles(t, dir, map[string]string{"a.txt": "two"})
+	bh.SetOverwrite(common.OverwriteNever)
+	if err := bh.UploadFiles(local, testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := getBlob(t, service, "a.txt"); got != "one" {
+		t.Errorf("got %q, expected the blob to be left as one", got)
+	}
+
+	bh.SetOverwrite(common.OverwriteIfDifferent)
+	if err := bh.UploadFiles(local, testContainer); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := getBlob(t, service, "a.txt"); got != "two" {
+		t.Errorf("got %q, expected the blob to be replaced with two", got)
+	}
+}
+
+// The filter sees the blob name, whichever way the local directory is written.
+func TestGetLocalFilesFilterName(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, _ := newTestHandler(t, dir)
+
+	local := filepath.Join(dir, "local")
+	writeFiles(t, local, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/c.log": "c"})
+
+	include, err := NewPattern("sub/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh.SetFilter(Filter{Include: []Pattern{include}})
+
+	root, restore := inParentDir(t, local)
+	defer restore()
+
+	for _, filePath := range []string{root, root + "/", root + "//", local} {
+		files, err := bh.getLocalFiles(filePath)
+		if err != nil {
+			t.Fatalf("%s: %s", filePath, err)
+		}
+
+		if len(files) != 1 || filepath.Base(files[0]) != "b.txt" {
+			t.Errorf("%s: got %v, expected just sub/b.txt", filePath, files)
+		}
+	}
+}
+
+func TestUploadMissingLocal(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	if err := bh.UploadFiles(filepath.Join(dir, "missing")+string(os.PathSeparator), testContainer); err == nil {
+		t.Errorf("expected an error uploading a directory that doesn't exist")
+	}
+
+	if names := blobNames(t, service); len(names) != 0 {
+		t.Errorf("got blobs %v, expected none", names)
+	}
+}
+
+// A file that can't be named is reported as failed instead of stopping the whole upload.
+func TestUploadFileOutsideLocal(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+	writeFiles(t, filepath.Join(dir, "up"), map[string]string{"a.txt": "a"})
+	writeFiles(t, filepath.Join(dir, "other"), map[string]string{"b.txt": "b"})
+
+	files := []string{filepath.Join(dir, "up", "a.txt"), filepath.Join(dir, "other", "b.txt")}
+	err := bh.uploadFileList(testContainer, filepath.Join(dir, "up"), files)
+	if err == nil || !strings.Contains(err.Error(), "isn't below") {
+		t.Errorf("expected the file outside -local to fail, got %v", err)
+	}
+
+	if names := blobNames(t, service); !reflect.DeepEqual(names, []string{"a.txt"}) {
+		t.Errorf("got blobs %v, expected [a.txt]", names)
+	}
+}
+
+func TestGenerateBlobNameMissingLocal(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	missing := filepath.Join(dir, "missing")
+	if name, err := generateBlobName(filepath.Join(missing, "a.txt"), missing); err == nil {
+		t.Errorf("got %q, expected an error as %s doesn't exist", name, missing)
+	}
+}
+
+// Streams (eg from S3) get the same content properties as uploaded files, whatever the source had.
+func TestUploadStreamContentProperties(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	bh, service := newTestHandler(t, dir)
+
+	rule, err := NewPattern("site/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bh.SetContentSettings(ContentSettings{
+		Rules:     []ContentRule{{Pattern: rule, Properties: ContentProperties{CacheControl: "no-cache"}}},
+		Overrides: ContentProperties{ContentDisposition: "inline"},
+	})
+
+	tests := []struct {
+		name     string
+		data     string
+		expected ContentProperties
+	}{
+		{"site/index", "<html><body>hi</body></html>", ContentProperties{ContentType: "text/html; charset=utf-8", CacheControl: "no-cache", ContentDisposition: "inline"}},
+		{"site/app.js.gz", "\x1f\x8b", ContentProperties{ContentType: mime.TypeByExtension(".js"), ContentEncoding: "gzip", CacheControl: "no-cache", ContentDisposition: "inline"}},
+		{"empty", "", ContentProperties{ContentDisposition: "inline"}},
+	}
+
+	for _, test := range tests {
+		blob := service.GetContainerReference(testContainer).GetBlobReference(test.name)
+		if err := bh.uploadStream(strings.NewReader(test.data), int64(len(test.data)), blob); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		data, props := getBlob(t, service, test.name)
+		if data != test.data {
+			t.Errorf("%s: got %q, expected %q", test.name, data, test.data)
+		}
+
+		got := ContentProperties{ContentType: props.ContentType, ContentEncoding: props.ContentEncoding, CacheControl: props.CacheControl, ContentDisposition: props.ContentDisposition}
+		if got != test.expected {
+			t.Errorf("%s: got %+v, expected %+v", test.name, got, test.expected)
+		}
+	}
+}
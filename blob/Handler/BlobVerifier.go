@@ -0,0 +1,174 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// verifyResults collects what verify found for each file/blob across multiple goroutines.
+type verifyResults struct {
+	lock       sync.Mutex
+	matched    int
+	unverified []string // blobs without a Content-MD5, only the size could be compared
+	mismatches map[string]string
+}
+
+func (vr *verifyResults) addMatched(blobName string, hasMD5 bool) {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+
+	vr.matched++
+	if !hasMD5 {
+		vr.unverified = append(vr.unverified, blobName)
+	}
+}
+
+func (vr *verifyResults) addMismatch(blobName string, reason string) {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+	vr.mismatches[blobName] = reason
+}
+
+// VerifyFiles compares the local files under filePath with the blobs in the container, same names as upload gives them.
+// Files are compared by size and MD5 (blobs without a Content-MD5 only by size). Files without a blob and blobs without
+// a local file are mismatches too. Only blobs starting with blobPrefix (and the matching local files) are compared.
+// Every mismatch is printed, the returned error says how many there were.
+func (bh BlobHandler) VerifyFiles(filePath string, containerName string, blobPrefix string) error {
+	log.Debugf("VerifyFiles %s %s %s", filePath, containerName, blobPrefix)
+
+	blobs := make(map[string]storage.Blob)
+	err := bh.WalkBlobs(containerName, blobPrefix, "", func(item BlobListItem) error {
+		blobs[item.Blob.Name] = item.Blob
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	results := &verifyResults{mismatches: make(map[string]string)}
+	localFiles := make(map[string]string)
+	allFiles, err := bh.getLocalFiles(filePath)
+	if err != nil {
+		return err
+	}
+
+	for _, localFile := range allFiles {
+		blobName, err := generateBlobName(localFile, filePath)
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(blobName, blobPrefix) {
+			continue
+		}
+
+		if _, ok := blobs[blobName]; !ok {
+			results.addMismatch(blobName, "no blob for local file "+localFile)
+			continue
+		}
+		localFiles[blobName] = localFile
+	}
+
+	for blobName := range blobs {
+		if _, ok := localFiles[blobName]; !ok && results.mismatches[blobName] == "" {
+			results.addMismatch(blobName, "no local file")
+		}
+	}
+
+	// MD5 of each local file is worked out using concurrentFactor goroutines.
+	verifyChannel := make(chan string, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < int(bh.concurrentFactor); i++ {
+		wg.Add(1)
+		go verifyFileFromChannel(verifyChannel, localFiles, blobs, results, &wg)
+	}
+
+	for blobName := range localFiles {
+		verifyChannel <- blobName
+	}
+	close(verifyChannel)
+	wg.Wait()
+
+	return results.report()
+}
+
+// verifyFileFromChannel reads blob names from channel and compares the blob with its local file.
+func verifyFileFromChannel(verifyChannel chan string, localFiles map[string]string, blobs map[string]storage.Blob, results *verifyResults, wg *sync.WaitGroup) {
+
+	defer wg.Done()
+
+	for blobName := range verifyChannel {
+		reason, err := compareLocalFile(localFiles[blobName], blobs[blobName].Properties)
+		if err != nil {
+			log.Debugf("verify %s failed %s", blobName, err)
+			reason = err.Error()
+		}
+
+		if reason != "" {
+			results.addMismatch(blobName, reason)
+			continue
+		}
+		results.addMatched(blobName, blobs[blobName].Properties.ContentMD5 != "")
+	}
+}
+
+// compareLocalFile returns why the local file doesn't match the blob, "" if it does.
+func compareLocalFile(localFile string, props storage.BlobProperties) (string, error) {
+	fi, err := os.Stat(localFile)
+	if err != nil {
+		return "", err
+	}
+
+	if fi.Size() != props.ContentLength {
+		return fmt.Sprintf("size differs, local file %d bytes, blob %d bytes", fi.Size(), props.ContentLength), nil
+	}
+
+	if props.ContentMD5 == "" {
+		return "", nil
+	}
+
+	localMD5, err := localFileMD5(localFile)
+	if err != nil {
+		return "", err
+	}
+
+	if localMD5 != props.ContentMD5 {
+		return fmt.Sprintf("MD5 differs, local file %s, blob %s", localMD5, props.ContentMD5), nil
+	}
+
+	return "", nil
+}
+
+// report prints the mismatches (sorted by name) and the totals. Returns an error if anything didn't match.
+func (vr *verifyResults) report() error {
+	vr.lock.Lock()
+	defer vr.lock.Unlock()
+
+	blobNames := []string{}
+	for blobName := range vr.mismatches {
+		blobNames = append(blobNames, blobName)
+	}
+	sort.Strings(blobNames)
+
+	for _, blobName := range blobNames {
+		fmt.Printf("%s: %s\n", blobName, vr.mismatches[blobName])
+	}
+
+	sort.Strings(vr.unverified)
+	for _, blobName := range vr.unverified {
+		fmt.Printf("%s: blob has no MD5, only the size was compared\n", blobName)
+	}
+
+	fmt.Printf("Verified %d files, %d mismatched, %d without MD5\n", vr.matched+len(vr.mismatches), len(vr.mismatches), len(vr.unverified))
+	if len(vr.mismatches) > 0 {
+		return fmt.Errorf("%d files don't match their blobs", len(vr.mismatches))
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// bytes read from the start of a file to sniff its content type.
+const sniffLength = 512
+
+// precompressed extensions and the Content-Encoding they get, eg app.js.gz is javascript encoded with gzip.
+var precompressedEncodings = map[string]string{
+	".gz": "gzip",
+	".br": "br",
+}
+
+// ContentProperties are the HTTP properties of a blob, used when it's served (eg from a $web container).
+type ContentProperties struct {
+	ContentType        string
+	ContentEncoding    string
+	CacheControl       string
+	ContentDisposition string
+}
+
+// merge overrides p with whatever is set in other.
+func (p ContentProperties) merge(other ContentProperties) ContentProperties {
+	if other.ContentType != "" {
+		p.ContentType = other.ContentType
+	}
+	if other.ContentEncoding != "" {
+		p.ContentEncoding = other.ContentEncoding
+	}
+	if other.CacheControl != "" {
+		p.CacheControl = other.CacheControl
+	}
+	if other.ContentDisposition != "" {
+		p.ContentDisposition = other.ContentDisposition
+	}
+	return p
+}
+
+// ContentRule sets properties for the blobs whose names match the pattern.
+type ContentRule struct {
+	Pattern    Pattern
+	Properties ContentProperties
+}
+
+// ContentSettings work out the properties of uploaded blobs. The content type (and encoding of precompressed files)
+// is detected from the name, or sniffed from the data if the extension isn't known. Then every matching rule is
+// applied in order, later rules trumping earlier ones, and finally the overrides (from flags) trump everything.
+type ContentSettings struct {
+	Rules     []ContentRule
+	Overrides ContentProperties
+}
+
+// SetContentSettings sets how the properties of uploaded blobs are worked out.
+func (bh *BlobHandler) SetContentSettings(settings ContentSettings) {
+	bh.content = settings
+}
+
+// properties works out the properties for the blob from its name and the data (a local file, or the start of a stream).
+func (cs ContentSettings) properties(blobName string, data io.ReaderAt) (ContentProperties, error) {
+	props, err := detectContent(blobName, data)
+	if err != nil {
+		return props, err
+	}
+
+	for _, rule := range cs.Rules {
+		if rule.Pattern.Match(blobName) {
+			props = props.merge(rule.Properties)
+		}
+	}
+
+	return props.merge(cs.Overrides), nil
+}
+
+// detectContent gets the content type from the extension, sniffing the start of the data if it's not known.
+// Precompressed web files (eg style.css.gz) get the type of the inner extension and a Content-Encoding.
+func detectContent(blobName string, data io.ReaderAt) (ContentProperties, error) {
+	props := ContentProperties{}
+	ext := strings.ToLower(path.Ext(blobName))
+
+	if encoding, ok := precompressedEncodings[ext]; ok {
+		inner := mime.TypeByExtension(strings.ToLower(path.Ext(strings.TrimSuffix(blobName, path.Ext(blobName)))))
+		if isWebType(inner) {
+			props.ContentType = inner
+			props.ContentEncoding = encoding
+			return props, nil
+		}
+	}
+
+	props.ContentType = mime.TypeByExtension(ext)
+	if props.ContentType != "" {
+		return props, nil
+	}
+
+	buffer := make([]byte, sniffLength)
+	n, err := data.ReadAt(buffer, 0)
+	if err != nil && err != io.EOF {
+		return props, err
+	}
+
+	// empty blobs are left as the default (application/octet-stream).
+	if n > 0 {
+		props.ContentType = http.DetectContentType(buffer[:n])
+	}
+	return props, nil
+}
+
+// isWebType checks if the content type is something browsers decompress and use as is (html, css, js etc),
+// rather than an archive that happens to be compressed (eg .tar.gz).
+func isWebType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case "application/javascript", "text/javascript", "application/json", "application/xml", "image/svg+xml", "application/wasm":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// setContentProperties puts the properties on the blob, they're sent when the block list is put.
+// Anything not set is cleared, so the blob doesn't keep properties from before it was replaced.
+func setContentProperties(blobProperties *storage.BlobProperties, props ContentProperties) {
+	blobProperties.ContentType = props.ContentType
+	blobProperties.ContentEncoding = props.ContentEncoding
+	blobProperties.CacheControl = props.CacheControl
+	blobProperties.ContentDisposition = props.ContentDisposition
+}
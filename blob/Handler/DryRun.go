@@ -0,0 +1,142 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// what a dry run would do to each object.
+const (
+	planCreate    = "create"
+	planOverwrite = "overwrite"
+	planDelete    = "delete"
+	planSkip      = "skip" // destination exists and the overwrite policy leaves it alone
+)
+
+// SetDryRun makes every command only work out and print what it would create, overwrite or delete.
+// Reads (listing, checking what exists) still happen, nothing is written.
+func (bh *BlobHandler) SetDryRun(dryRun bool) {
+	bh.dryRun = dryRun
+}
+
+// dryRunPlan prints each object a command would change and totals them up.
+type dryRunPlan struct {
+	counts map[string]int
+	sizes  map[string]int64
+}
+
+func newDryRunPlan() *dryRunPlan {
+	return &dryRunPlan{counts: make(map[string]int), sizes: make(map[string]int64)}
+}
+
+// add prints the planned action for the object, eg "would overwrite temp/logs/a.log (1.2K)".
+func (p *dryRunPlan) add(action string, name string, size int64) {
+	fmt.Printf("would %s %s (%s)\n", action, name, common.FormatSize(size))
+	p.counts[action]++
+	p.sizes[action] += size
+}
+
+// addExisting is add with create or overwrite depending on whether the destination exists.
+func (p *dryRunPlan) addExisting(exists bool, name string, size int64) {
+	if exists {
+		p.add(planOverwrite, name, size)
+		return
+	}
+	p.add(planCreate, name, size)
+}
+
+// summary prints the totals of the plan.
+func (p *dryRunPlan) summary() {
+	fmt.Printf("Dry run, nothing changed: %d to create (%s), %d to overwrite (%s), %d to delete (%s), %d to skip (%s)\n",
+		p.counts[planCreate], common.FormatSize(p.sizes[planCreate]),
+		p.counts[planOverwrite], common.FormatSize(p.sizes[planOverwrite]),
+		p.counts[planDelete], common.FormatSize(p.sizes[planDelete]),
+		p.counts[planSkip], common.FormatSize(p.sizes[planSkip]))
+}
+
+// blobExists checks if the blob exists, populating its properties if so.
+func blobExists(blob Blob) (bool, error) {
+	err := blob.GetProperties(nil)
+	if serr, ok := err.(storage.AzureStorageServiceError); ok && serr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// localFileExists checks if the local file exists.
+func localFileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// objectExists checks if the S3 object exists.
+func (sh S3Handler) objectExists(bucket string, key string) (bool, error) {
+	_, err := sh.client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() == http.StatusNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// planUpload prints which blobs uploading the local files (all under filePath) would create, overwrite or skip.
+func (bh BlobHandler) planUpload(plan *dryRunPlan, containerName string, filePath string, fileList []string) error {
+	container := bh.blobStorageClient.GetContainerReference(containerName)
+	for _, localFile := range fileList {
+		fi, err := os.Stat(localFile)
+		if err != nil {
+			return err
+		}
+
+		blobName, err := generateBlobName(localFile, filePath)
+		if err != nil {
+			return err
+		}
+
+		blob := container.GetBlobReference(blobName)
+		_, skip, err := bh.uploadConditions(localFile, blob)
+		if err != nil {
+			return err
+		}
+
+		if skip != "" {
+			plan.add(planSkip, containerName+"/"+blobName, fi.Size())
+			continue
+		}
+
+		exists, err := blobExists(blob)
+		if err != nil {
+			return err
+		}
+		plan.addExisting(exists, containerName+"/"+blobName, fi.Size())
+	}
+	return nil
+}
+
+// planDownload prints which local files downloading the blobs would create or overwrite.
+func planDownload(plan *dryRunPlan, filePath string, blob storage.Blob) error {
+	localFile, err := generateLocalName(filePath, blob.Name)
+	if err != nil {
+		return err
+	}
+
+	exists, err := localFileExists(localFile)
+	if err != nil {
+		return err
+	}
+
+	plan.addExisting(exists, localFile, blob.Properties.ContentLength)
+	return nil
+}
@@ -0,0 +1,184 @@
+package Handler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// IgnoreFileName is the file in the local root listing patterns to exclude, one per line.
+const IgnoreFileName = ".astignore"
+
+// regexPrefix marks a pattern as a regular expression instead of a glob.
+const regexPrefix = "regex:"
+
+// Pattern matches blob names (or local paths relative to the local root, using /).
+type Pattern struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// NewPattern parses a glob (eg *.log, logs/**/*.gz) or, prefixed with regex:, a regular expression.
+// Globs without a / match the last part of the name (like .gitignore), a trailing / matches everything below it.
+// Regular expressions match anywhere in the name unless anchored.
+func NewPattern(pattern string) (Pattern, error) {
+	if strings.HasPrefix(pattern, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, regexPrefix))
+		if err != nil {
+			return Pattern{}, fmt.Errorf("Invalid pattern %s: %s", pattern, err)
+		}
+		return Pattern{pattern: pattern, re: re}, nil
+	}
+
+	if pattern == "" {
+		return Pattern{}, fmt.Errorf("Invalid pattern, can't be empty")
+	}
+
+	re, err := regexp.Compile(globToRegexp(pattern))
+	if err != nil {
+		return Pattern{}, fmt.Errorf("Invalid pattern %s: %s", pattern, err)
+	}
+	return Pattern{pattern: pattern, re: re}, nil
+}
+
+// globToRegexp converts the glob. * and ? don't match /, ** matches anything (**/ any number of directories).
+func globToRegexp(glob string) string {
+	if strings.HasSuffix(glob, "/") {
+		glob += "**"
+	}
+
+	var b bytes.Buffer
+	if strings.Contains(strings.TrimSuffix(glob, "/**"), "/") {
+		b.WriteString("^")
+		glob = strings.TrimPrefix(glob, "/")
+	} else {
+		b.WriteString("(^|/)")
+	}
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				// any number of directories, including none.
+				b.WriteString("(.*/)?")
+				i += 2
+				continue
+			}
+			if strings.HasPrefix(glob[i:], "**") {
+				b.WriteString(".*")
+				i++
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// Match reports if the name matches the pattern.
+func (p Pattern) Match(name string) bool {
+	return p.re.MatchString(name)
+}
+
+func (p Pattern) String() string {
+	return p.pattern
+}
+
+// ReadIgnoreFile reads the exclude patterns in the ignore file. Blank lines and # comments are skipped.
+// A missing file has no patterns.
+func ReadIgnoreFile(path string) ([]Pattern, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns := []Pattern{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := NewPattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	return patterns, scanner.Err()
+}
+
+// Filter picks which files/blobs a command works on. The zero Filter matches everything.
+type Filter struct {
+	// if any, names must match at least one.
+	Include []Pattern
+
+	// names must match none.
+	Exclude []Pattern
+
+	// only modified after NewerThan (if not zero).
+	NewerThan time.Time
+
+	// only larger than LargerThan bytes (if not zero).
+	LargerThan int64
+}
+
+// Match reports if the file/blob passes the filter.
+func (f Filter) Match(name string, size int64, modified time.Time) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+
+	if matchAny(f.Exclude, name) {
+		return false
+	}
+
+	if !f.NewerThan.IsZero() && !modified.After(f.NewerThan) {
+		return false
+	}
+
+	return f.LargerThan == 0 || size > f.LargerThan
+}
+
+func matchAny(patterns []Pattern, name string) bool {
+	for _, p := range patterns {
+		if p.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFilter sets the filter used by upload, download, list, delete and copy.
+func (bh *BlobHandler) SetFilter(filter Filter) {
+	bh.filter = filter
+}
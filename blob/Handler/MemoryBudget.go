@@ -0,0 +1,40 @@
+package Handler
+
+import (
+	"sync"
+)
+
+// memoryBudget limits how many bytes of block buffers are held at once across every upload goroutine.
+type memoryBudget struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	mb := memoryBudget{limit: limit}
+	mb.cond = sync.NewCond(&mb.lock)
+	return &mb
+}
+
+// acquire blocks until size bytes are available.
+// A request larger than the whole budget is allowed through once nothing else is using it.
+func (mb *memoryBudget) acquire(size int64) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	for mb.used > 0 && mb.used+size > mb.limit {
+		mb.cond.Wait()
+	}
+	mb.used += size
+}
+
+// release returns size bytes to the budget.
+func (mb *memoryBudget) release(size int64) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.used -= size
+	mb.cond.Broadcast()
+}
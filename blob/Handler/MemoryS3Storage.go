@@ -0,0 +1,169 @@
+package Handler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// objects in a page when listing doesn't ask for a number, same as S3.
+const memoryS3PageSize = 1000
+
+// MemoryS3Service is an in-memory S3Service so S3 copies can be run (and tested) without S3.
+// Buckets have to be created before objects are uploaded to them. Uploads are never split into parts.
+type MemoryS3Service struct {
+	lock    sync.Mutex
+	buckets map[string]map[string]memoryS3Object
+}
+
+// memoryS3Object is the stored state of a single object.
+type memoryS3Object struct {
+	data         []byte
+	lastModified time.Time
+}
+
+// NewMemoryS3Service creates a MemoryS3Service without any buckets.
+func NewMemoryS3Service() *MemoryS3Service {
+	return &MemoryS3Service{buckets: make(map[string]map[string]memoryS3Object)}
+}
+
+// memoryS3Error creates the same error type the SDK returns for failed requests.
+func memoryS3Error(statusCode int, code string) error {
+	return awserr.NewRequestFailure(awserr.New(code, fmt.Sprintf("%d %s", statusCode, code), nil), statusCode, "")
+}
+
+// CreateBucket creates the bucket if it doesn't already exist.
+func (s *MemoryS3Service) CreateBucket(bucket string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[bucket]; !ok {
+		s.buckets[bucket] = make(map[string]memoryS3Object)
+	}
+}
+
+// PutObject stores the object (creating the bucket if needed) with the given last modified time.
+func (s *MemoryS3Service) PutObject(bucket string, key string, data []byte, lastModified time.Time) {
+	s.CreateBucket(bucket)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.buckets[bucket][key] = memoryS3Object{data: data, lastModified: lastModified}
+}
+
+// getObject returns the object, failing the same way S3 does if the bucket or object doesn't exist. Caller holds the lock.
+func (s *MemoryS3Service) getObject(bucket string, key string) (memoryS3Object, error) {
+	objects, ok := s.buckets[bucket]
+	if !ok {
+		return memoryS3Object{}, memoryS3Error(http.StatusNotFound, s3.ErrCodeNoSuchBucket)
+	}
+
+	obj, ok := objects[key]
+	if !ok {
+		return memoryS3Object{}, memoryS3Error(http.StatusNotFound, s3.ErrCodeNoSuchKey)
+	}
+	return obj, nil
+}
+
+// ListObjectsV2Pages lists the objects starting with Prefix in key order, MaxKeys (or 1000) at a time.
+// Delimiter isn't supported.
+func (s *MemoryS3Service) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	s.lock.Lock()
+	objects, ok := s.buckets[aws.StringValue(input.Bucket)]
+	if !ok {
+		s.lock.Unlock()
+		return memoryS3Error(http.StatusNotFound, s3.ErrCodeNoSuchBucket)
+	}
+
+	prefix := aws.StringValue(input.Prefix)
+	keys := []string{}
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	contents := make([]*s3.Object, len(keys))
+	for i, key := range keys {
+		obj := objects[key]
+		contents[i] = &s3.Object{Key: aws.String(key), Size: aws.Int64(int64(len(obj.data))), LastModified: aws.Time(obj.lastModified)}
+	}
+	s.lock.Unlock()
+
+	pageSize := int(aws.Int64Value(input.MaxKeys))
+	if pageSize <= 0 {
+		pageSize = memoryS3PageSize
+	}
+
+	// fn is called without the lock, so it can use the service.
+	for start := 0; ; start += pageSize {
+		end := start + pageSize
+		if end > len(contents) {
+			end = len(contents)
+		}
+
+		lastPage := end == len(contents)
+		page := &s3.ListObjectsV2Output{Contents: contents[start:end], KeyCount: aws.Int64(int64(end - start)), IsTruncated: aws.Bool(!lastPage)}
+		if !fn(page, lastPage) || lastPage {
+			return nil
+		}
+	}
+}
+
+func (s *MemoryS3Service) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, err := s.getObject(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(obj.data))), LastModified: aws.Time(obj.lastModified)}, nil
+}
+
+func (s *MemoryS3Service) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	obj, err := s.getObject(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(obj.data)),
+		ContentLength: aws.Int64(int64(len(obj.data))),
+		LastModified:  aws.Time(obj.lastModified),
+	}, nil
+}
+
+// Upload reads the whole body and stores it as the object, modified now.
+func (s *MemoryS3Service) Upload(input *s3manager.UploadInput, partConcurrency int) error {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects, ok := s.buckets[aws.StringValue(input.Bucket)]
+	if !ok {
+		return memoryS3Error(http.StatusNotFound, s3.ErrCodeNoSuchBucket)
+	}
+
+	objects[aws.StringValue(input.Key)] = memoryS3Object{data: data, lastModified: time.Now()}
+	return nil
+}
@@ -0,0 +1,511 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// base URL for containers/blobs in MemoryBlobService.
+const memoryBaseURL = "https://memory.blob.local"
+
+// MemoryBlobService is an in-memory BlobService so BlobHandler can be run (and tested) without an Azure account.
+// Blocks, block lists, properties, listing and copies behave like Azure (copies complete straight away).
+// Leases and snapshots are ignored, conditional headers are only checked when putting a block list or getting a blob or range.
+type MemoryBlobService struct {
+	lock       sync.Mutex
+	containers map[string]map[string]*memoryBlobData
+	etag       int
+}
+
+// memoryBlobData is the stored state of a single blob.
+// A blob only exists (for listing, get etc) once its block list has been put.
+type memoryBlobData struct {
+	exists      bool
+	data        []byte
+	properties  storage.BlobProperties
+	committed   []string
+	blocks      map[string][]byte
+	uncommitted map[string][]byte
+}
+
+// NewMemoryBlobService creates an empty MemoryBlobService.
+func NewMemoryBlobService() *MemoryBlobService {
+	return &MemoryBlobService{containers: make(map[string]map[string]*memoryBlobData)}
+}
+
+// memoryError creates the same error type the SDK returns for failed requests.
+func memoryError(statusCode int, code string) error {
+	return storage.AzureStorageServiceError{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    fmt.Sprintf("%d %s", statusCode, code),
+	}
+}
+
+// GetContainerReference returns a reference to the container, which may not exist yet.
+func (s *MemoryBlobService) GetContainerReference(name string) Container {
+	return memoryContainer{service: s, name: name}
+}
+
+// ListContainers lists containers in name order. Marker is the name of the next container.
+func (s *MemoryBlobService) ListContainers(params storage.ListContainersParameters) (*storage.ContainerListResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	names := []string{}
+	for name := range s.containers {
+		if strings.HasPrefix(name, params.Prefix) && name >= params.Marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	resp := storage.ContainerListResponse{}
+	for i, name := range names {
+		if params.MaxResults > 0 && uint(i) == params.MaxResults {
+			resp.NextMarker = name
+			break
+		}
+		resp.Containers = append(resp.Containers, storage.Container{Name: name})
+	}
+
+	return &resp, nil
+}
+
+// getBlobData returns the blob, creating an entry for it if create is set. Caller holds the lock.
+func (s *MemoryBlobService) getBlobData(containerName string, blobName string, create bool) (*memoryBlobData, error) {
+	blobs, ok := s.containers[containerName]
+	if !ok {
+		return nil, memoryError(http.StatusNotFound, "ContainerNotFound")
+	}
+
+	data, ok := blobs[blobName]
+	if !ok {
+		if !create {
+			return nil, memoryError(http.StatusNotFound, "BlobNotFound")
+		}
+		data = &memoryBlobData{blocks: make(map[string][]byte), uncommitted: make(map[string][]byte)}
+		blobs[blobName] = data
+	}
+
+	return data, nil
+}
+
+// getExistingBlobData returns the blob only if it has been committed. Caller holds the lock.
+func (s *MemoryBlobService) getExistingBlobData(containerName string, blobName string) (*memoryBlobData, error) {
+	data, err := s.getBlobData(containerName, blobName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !data.exists {
+		return nil, memoryError(http.StatusNotFound, "BlobNotFound")
+	}
+	return data, nil
+}
+
+// commit sets the content of the blob and updates the properties that Azure would. Caller holds the lock.
+func (s *MemoryBlobService) commit(data *memoryBlobData, content []byte) {
+	s.etag++
+	data.exists = true
+	data.data = content
+	data.properties.ContentLength = int64(len(content))
+	data.properties.LastModified = storage.TimeRFC1123(time.Now().UTC().Truncate(time.Second))
+	data.properties.Etag = fmt.Sprintf("\"0x%X\"", s.etag)
+	data.properties.BlobType = storage.BlobTypeBlock
+}
+
+type memoryContainer struct {
+	service *MemoryBlobService
+	name    string
+}
+
+func (c memoryContainer) Exists() (bool, error) {
+	c.service.lock.Lock()
+	defer c.service.lock.Unlock()
+
+	_, ok := c.service.containers[c.name]
+	return ok, nil
+}
+
+func (c memoryContainer) CreateIfNotExists(options *storage.CreateContainerOptions) (bool, error) {
+	c.service.lock.Lock()
+	defer c.service.lock.Unlock()
+
+	if _, ok := c.service.containers[c.name]; ok {
+		return false, nil
+	}
+
+	c.service.containers[c.name] = make(map[string]*memoryBlobData)
+	return true, nil
+}
+
+// ListBlobs lists committed blobs in name order. Delimiter groups names into BlobPrefixes
+// and Marker is the name of the next blob (or prefix).
+func (c memoryContainer) ListBlobs(params storage.ListBlobsParameters) (storage.BlobListResponse, error) {
+	c.service.lock.Lock()
+	defer c.service.lock.Unlock()
+
+	resp := storage.BlobListResponse{Delimiter: params.Delimiter}
+	blobs, ok := c.service.containers[c.name]
+	if !ok {
+		return resp, memoryError(http.StatusNotFound, "ContainerNotFound")
+	}
+
+	// names (and virtual directories if there is a delimiter) in order.
+	entries := []string{}
+	prefixes := make(map[string]bool)
+	for name, data := range blobs {
+		if !data.exists || !strings.HasPrefix(name, params.Prefix) {
+			continue
+		}
+
+		if params.Delimiter != "" {
+			if i := strings.Index(name[len(params.Prefix):], params.Delimiter); i >= 0 {
+				prefix := name[:len(params.Prefix)+i+len(params.Delimiter)]
+				if !prefixes[prefix] {
+					prefixes[prefix] = true
+					entries = append(entries, prefix)
+				}
+				continue
+			}
+		}
+
+		entries = append(entries, name)
+	}
+	sort.Strings(entries)
+
+	maxResults := params.MaxResults
+	if maxResults == 0 {
+		maxResults = 5000
+	}
+
+	count := uint(0)
+	for _, entry := range entries {
+		if entry < params.Marker {
+			continue
+		}
+
+		if count == maxResults {
+			resp.NextMarker = entry
+			break
+		}
+		count++
+
+		if prefixes[entry] {
+			resp.BlobPrefixes = append(resp.BlobPrefixes, entry)
+			continue
+		}
+
+		data := blobs[entry]
+		resp.Blobs = append(resp.Blobs, storage.Blob{Name: entry, Properties: data.properties})
+	}
+
+	return resp, nil
+}
+
+func (c memoryContainer) GetBlobReference(name string) Blob {
+	return &memoryBlob{service: c.service, container: c.name, name: name}
+}
+
+func (c memoryContainer) GetURL() string {
+	return fmt.Sprintf("%s/%s", memoryBaseURL, c.name)
+}
+
+// memoryBlob is a reference to a blob, same as storage.Blob it has its own copy of the properties.
+type memoryBlob struct {
+	service    *MemoryBlobService
+	container  string
+	name       string
+	properties storage.BlobProperties
+}
+
+func (b *memoryBlob) Name() string {
+	return b.name
+}
+
+func (b *memoryBlob) Properties() *storage.BlobProperties {
+	return &b.properties
+}
+
+func (b *memoryBlob) GetURL() string {
+	return fmt.Sprintf("%s/%s/%s", memoryBaseURL, b.container, b.name)
+}
+
+func (b *memoryBlob) GetProperties(options *storage.GetBlobPropertiesOptions) error {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getExistingBlobData(b.container, b.name)
+	if err != nil {
+		return err
+	}
+
+	b.properties = data.properties
+	return nil
+}
+
+func (b *memoryBlob) Get(options *storage.GetBlobOptions) (io.ReadCloser, error) {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getExistingBlobData(b.container, b.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if options != nil && options.IfMatch != "" && options.IfMatch != data.properties.Etag {
+		return nil, memoryError(http.StatusPreconditionFailed, "ConditionNotMet")
+	}
+
+	b.properties = data.properties
+	return ioutil.NopCloser(bytes.NewReader(data.data)), nil
+}
+
+func (b *memoryBlob) GetRange(options *storage.GetBlobRangeOptions) (io.ReadCloser, error) {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getExistingBlobData(b.container, b.name)
+	if err != nil {
+		return nil, err
+	}
+
+	if options != nil && options.GetBlobOptions != nil && options.IfMatch != "" && options.IfMatch != data.properties.Etag {
+		return nil, memoryError(http.StatusPreconditionFailed, "ConditionNotMet")
+	}
+
+	if options == nil || options.Range == nil {
+		return ioutil.NopCloser(bytes.NewReader(data.data)), nil
+	}
+
+	r := options.Range
+	if r.Start > r.End || r.Start >= uint64(len(data.data)) {
+		return nil, memoryError(http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+	}
+
+	end := r.End + 1
+	if end > uint64(len(data.data)) {
+		end = uint64(len(data.data))
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data.data[r.Start:end])), nil
+}
+
+func (b *memoryBlob) Delete(options *storage.DeleteBlobOptions) error {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	if _, err := b.service.getExistingBlobData(b.container, b.name); err != nil {
+		return err
+	}
+
+	delete(b.service.containers[b.container], b.name)
+	return nil
+}
+
+func (b *memoryBlob) PutBlock(blockID string, chunk []byte, options *storage.PutBlockOptions) error {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getBlobData(b.container, b.name, true)
+	if err != nil {
+		return err
+	}
+
+	if options != nil && options.ContentMD5 != "" {
+		chunkMD5 := md5.Sum(chunk)
+		if base64.StdEncoding.EncodeToString(chunkMD5[:]) != options.ContentMD5 {
+			return memoryError(http.StatusBadRequest, "Md5Mismatch")
+		}
+	}
+
+	block := make([]byte, len(chunk))
+	copy(block, chunk)
+	data.uncommitted[blockID] = block
+	return nil
+}
+
+// PutBlockList builds the blob from the blocks. Latest means uncommitted if there is one, otherwise committed.
+// Content properties set on this reference are stored with the blob, same as the x-ms-blob-* headers.
+func (b *memoryBlob) PutBlockList(blocks []storage.Block, options *storage.PutBlockListOptions) error {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getBlobData(b.container, b.name, true)
+	if err != nil {
+		return err
+	}
+
+	if err := checkConditions(data, options); err != nil {
+		return err
+	}
+
+	content := []byte{}
+	committed := []string{}
+	newBlocks := make(map[string][]byte)
+	for _, block := range blocks {
+		var chunk []byte
+		var ok bool
+
+		switch block.Status {
+		case storage.BlockStatusUncommitted:
+			chunk, ok = data.uncommitted[block.ID]
+		case storage.BlockStatusCommitted:
+			chunk, ok = data.blocks[block.ID]
+		default:
+			chunk, ok = data.uncommitted[block.ID]
+			if !ok {
+				chunk, ok = data.blocks[block.ID]
+			}
+		}
+
+		if !ok {
+			return memoryError(http.StatusBadRequest, "InvalidBlockList")
+		}
+
+		content = append(content, chunk...)
+		committed = append(committed, block.ID)
+		newBlocks[block.ID] = chunk
+	}
+
+	data.committed = committed
+	data.blocks = newBlocks
+	data.uncommitted = make(map[string][]byte)
+
+	data.properties.ContentType = b.properties.ContentType
+	data.properties.ContentEncoding = b.properties.ContentEncoding
+	data.properties.ContentLanguage = b.properties.ContentLanguage
+	data.properties.ContentDisposition = b.properties.ContentDisposition
+	data.properties.CacheControl = b.properties.CacheControl
+	data.properties.ContentMD5 = b.properties.ContentMD5
+
+	b.service.commit(data, content)
+	return nil
+}
+
+// checkConditions fails the same way Azure does if the blob doesn't meet the conditional headers.
+func checkConditions(data *memoryBlobData, options *storage.PutBlockListOptions) error {
+	if options == nil {
+		return nil
+	}
+
+	if options.IfNoneMatch == "*" && data.exists {
+		return memoryError(http.StatusConflict, "BlobAlreadyExists")
+	}
+
+	lastModified := time.Time(data.properties.LastModified)
+	switch {
+	case options.IfMatch != "" && (!data.exists || options.IfMatch != data.properties.Etag),
+		options.IfNoneMatch != "" && options.IfNoneMatch != "*" && data.exists && options.IfNoneMatch == data.properties.Etag,
+		options.IfModifiedSince != nil && data.exists && !lastModified.After(*options.IfModifiedSince),
+		options.IfUnmodifiedSince != nil && data.exists && lastModified.After(*options.IfUnmodifiedSince):
+		return memoryError(http.StatusPreconditionFailed, "ConditionNotMet")
+	}
+
+	return nil
+}
+
+func (b *memoryBlob) GetBlockList(blockType storage.BlockListType, options *storage.GetBlockListOptions) (storage.BlockListResponse, error) {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	resp := storage.BlockListResponse{}
+	data, err := b.service.getBlobData(b.container, b.name, false)
+	if err != nil {
+		return resp, err
+	}
+
+	if blockType == storage.BlockListTypeAll || blockType == storage.BlockListTypeCommitted {
+		for _, blockID := range data.committed {
+			resp.CommittedBlocks = append(resp.CommittedBlocks, storage.BlockResponse{Name: blockID, Size: int64(len(data.blocks[blockID]))})
+		}
+	}
+
+	if blockType == storage.BlockListTypeAll || blockType == storage.BlockListTypeUncommitted {
+		blockIDs := []string{}
+		for blockID := range data.uncommitted {
+			blockIDs = append(blockIDs, blockID)
+		}
+		sort.Strings(blockIDs)
+
+		for _, blockID := range blockIDs {
+			resp.UncommittedBlocks = append(resp.UncommittedBlocks, storage.BlockResponse{Name: blockID, Size: int64(len(data.uncommitted[blockID]))})
+		}
+	}
+
+	return resp, nil
+}
+
+// StartCopy copies a blob from the same MemoryBlobService (any query string, eg SAS, is ignored).
+// The copy completes straight away.
+func (b *memoryBlob) StartCopy(sourceBlob string, options *storage.CopyOptions) (string, error) {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	u, err := url.Parse(sourceBlob)
+	if err != nil || !strings.HasPrefix(sourceBlob, memoryBaseURL) {
+		return "", memoryError(http.StatusBadRequest, "InvalidSourceBlobUrl")
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		return "", memoryError(http.StatusBadRequest, "InvalidSourceBlobUrl")
+	}
+
+	source, err := b.service.getExistingBlobData(parts[0], parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	dest, err := b.service.getBlobData(b.container, b.name, true)
+	if err != nil {
+		return "", err
+	}
+
+	content := make([]byte, len(source.data))
+	copy(content, source.data)
+
+	dest.properties = source.properties
+	b.service.commit(dest, content)
+
+	dest.properties.CopyID = fmt.Sprintf("copy-%d", b.service.etag)
+	dest.properties.CopySource = sourceBlob
+	dest.properties.CopyStatus = copyStatusSuccess
+	dest.properties.CopyProgress = fmt.Sprintf("%d/%d", len(content), len(content))
+
+	return dest.properties.CopyID, nil
+}
+
+// AbortCopy fails unless the copy is still pending, which memory copies never are.
+func (b *memoryBlob) AbortCopy(copyID string, options *storage.AbortCopyOptions) error {
+	b.service.lock.Lock()
+	defer b.service.lock.Unlock()
+
+	data, err := b.service.getExistingBlobData(b.container, b.name)
+	if err != nil {
+		return err
+	}
+
+	if data.properties.CopyID != copyID {
+		return memoryError(http.StatusConflict, "CopyIdMismatch")
+	}
+
+	if data.properties.CopyStatus != copyStatusPending {
+		return memoryError(http.StatusConflict, "NoPendingCopyOperation")
+	}
+
+	data.properties.CopyStatus = copyStatusAborted
+	return nil
+}
@@ -0,0 +1,169 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// errBlobChanged is returned when a conditional block list put fails, ie the blob was created or
+// changed after the overwrite policy was checked.
+var errBlobChanged = errors.New("blob was created or changed since it was checked")
+
+// SetOverwrite sets what uploads and downloads do when the destination already exists,
+// one of common.OverwriteAlways, OverwriteNever, OverwriteIfNewer or OverwriteIfDifferent.
+func (bh *BlobHandler) SetOverwrite(policy string) {
+	bh.overwrite = policy
+}
+
+// overwriteAlways is true if the destination is replaced without checking it, the default.
+func (bh BlobHandler) overwriteAlways() bool {
+	return bh.overwrite == "" || bh.overwrite == common.OverwriteAlways
+}
+
+// skippedFiles keeps track of the files/blobs left alone because of the overwrite policy across multiple goroutines.
+type skippedFiles struct {
+	lock  sync.Mutex
+	count int
+}
+
+// add prints why the file/blob was skipped.
+func (sf *skippedFiles) add(name string, reason string) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	fmt.Printf("skipping %s, %s\n", name, reason)
+	sf.count++
+}
+
+func (sf *skippedFiles) total() int {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	return sf.count
+}
+
+// uploadConditions checks the blob against the overwrite policy. If the local file is to be uploaded the
+// returned options make the block list put conditional, so a blob created or changed in the meantime isn't replaced.
+// Otherwise skip says why the file isn't uploaded.
+func (bh BlobHandler) uploadConditions(localFile string, blob Blob) (options *storage.PutBlockListOptions, skip string, err error) {
+	if bh.overwriteAlways() {
+		return nil, "", nil
+	}
+
+	exists, err := blobExists(blob)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !exists {
+		return &storage.PutBlockListOptions{IfNoneMatch: "*"}, "", nil
+	}
+
+	if bh.overwrite == common.OverwriteNever {
+		return nil, "blob exists", nil
+	}
+
+	fi, err := os.Stat(localFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	skip, err = overwriteSkipReason(bh.overwrite, localFile, fi, *blob.Properties(), true)
+	if err != nil || skip != "" {
+		return nil, skip, err
+	}
+
+	if bh.overwrite == common.OverwriteIfNewer {
+		localModified := fi.ModTime().UTC().Truncate(time.Second)
+		return &storage.PutBlockListOptions{IfUnmodifiedSince: &localModified}, "", nil
+	}
+
+	return &storage.PutBlockListOptions{IfMatch: blob.Properties().Etag}, "", nil
+}
+
+// downloadSkipReason checks the local file against the overwrite policy.
+// Returns why the blob isn't downloaded, "" if it should be.
+func (bh BlobHandler) downloadSkipReason(blob Blob, localFile string) (string, error) {
+	if bh.overwriteAlways() {
+		return "", nil
+	}
+
+	fi, err := os.Stat(localFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if bh.overwrite == common.OverwriteNever {
+		return "local file exists", nil
+	}
+
+	if err := blob.GetProperties(nil); err != nil {
+		return "", err
+	}
+
+	return overwriteSkipReason(bh.overwrite, localFile, fi, *blob.Properties(), false)
+}
+
+// overwriteSkipReason compares an existing local file and blob for ifnewer and ifdifferent.
+// localIsSource is true for uploads. Returns why the destination is left alone, "" to replace it.
+func overwriteSkipReason(policy string, localFile string, fi os.FileInfo, props storage.BlobProperties, localIsSource bool) (string, error) {
+
+	// blob times only have second precision.
+	localModified := fi.ModTime().UTC().Truncate(time.Second)
+	blobModified := time.Time(props.LastModified).UTC()
+
+	switch policy {
+	case common.OverwriteIfNewer:
+		if localIsSource && !localModified.After(blobModified) {
+			return "blob is not older than the local file", nil
+		}
+
+		if !localIsSource && !blobModified.After(localModified) {
+			return "local file is not older than the blob", nil
+		}
+
+	case common.OverwriteIfDifferent:
+		if fi.Size() != props.ContentLength {
+			return "", nil
+		}
+
+		if props.ContentMD5 != "" {
+			localMD5, err := localFileMD5(localFile)
+			if err != nil {
+				return "", err
+			}
+
+			if localMD5 == props.ContentMD5 {
+				return "same MD5", nil
+			}
+			return "", nil
+		}
+
+		// no MD5 to compare. Blobs are last modified when uploaded, so the local file is the same unless changed since.
+		// Downloads get the blob's last modified, so same size and time is the same file.
+		if localIsSource && !localModified.After(blobModified) {
+			return "same size and not modified since uploaded", nil
+		}
+
+		if !localIsSource && localModified.Equal(blobModified) {
+			return "same size and last modified", nil
+		}
+	}
+
+	return "", nil
+}
+
+// isConditionFailed checks if the request failed because of a conditional header (If-Match etc).
+func isConditionFailed(err error) bool {
+	serr, ok := err.(storage.AzureStorageServiceError)
+	return ok && (serr.StatusCode == http.StatusPreconditionFailed || serr.StatusCode == http.StatusConflict)
+}
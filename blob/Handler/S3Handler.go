@@ -0,0 +1,129 @@
+package Handler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const s3URIPrefix = "s3://"
+
+// S3Handler reads and writes objects in S3 (or S3 compatible storage such as MinIO).
+// Used as the other end of copies to/from Azure Blob Storage.
+type S3Handler struct {
+	client S3Service
+}
+
+// S3Service is the part of the S3 client that S3Handler uses.
+// Real one wraps s3.S3, MemoryS3Service is an in-memory fake.
+type S3Service interface {
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+
+	// Upload streams the body into the object, as a multipart upload of partConcurrency parts at a time if it's large.
+	Upload(input *s3manager.UploadInput, partConcurrency int) error
+}
+
+// awsS3Service is the S3Service backed by S3.
+type awsS3Service struct {
+	client *s3.S3
+}
+
+func (s awsS3Service) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	return s.client.ListObjectsV2Pages(input, fn)
+}
+
+func (s awsS3Service) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return s.client.HeadObject(input)
+}
+
+func (s awsS3Service) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return s.client.GetObject(input)
+}
+
+func (s awsS3Service) Upload(input *s3manager.UploadInput, partConcurrency int) error {
+	uploader := s3manager.NewUploaderWithClient(s.client, func(u *s3manager.Uploader) {
+		u.Concurrency = partConcurrency
+	})
+
+	_, err := uploader.Upload(input)
+	return err
+}
+
+// NewS3Handler create new instance of S3Handler
+// endpoint is optional, used for S3 compatible storage (eg http://localhost:9000 for a local MinIO).
+func NewS3Handler(accessID string, accessSecret string, region string, endpoint string) (*S3Handler, error) {
+	sh := new(S3Handler)
+
+	config := aws.NewConfig().WithRegion(region).WithCredentials(credentials.NewStaticCredentials(accessID, accessSecret, ""))
+
+	// S3 compatible storage generally doesn't do virtual host style buckets.
+	if endpoint != "" {
+		config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	sh.client = awsS3Service{client: s3.New(sess)}
+	return sh, nil
+}
+
+// NewS3HandlerWithService creates an S3Handler using the given S3Service (eg MemoryS3Service).
+func NewS3HandlerWithService(service S3Service) *S3Handler {
+	return &S3Handler{client: service}
+}
+
+// IsS3URI returns true if uri is of the form s3://bucket/prefix
+func IsS3URI(uri string) bool {
+	return strings.HasPrefix(uri, s3URIPrefix)
+}
+
+// ParseS3URI splits s3://bucket/prefix into bucket and prefix. Prefix may be empty.
+func ParseS3URI(uri string) (string, string, error) {
+	if !IsS3URI(uri) {
+		return "", "", fmt.Errorf("%s isn't an S3 URI (s3://bucket/prefix)", uri)
+	}
+
+	parts := strings.SplitN(uri[len(s3URIPrefix):], "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("%s doesn't have a bucket", uri)
+	}
+
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+// walkObjects calls fn with the key, size and last modified time of every object in the bucket starting with prefix, a page at a time.
+// Listing stops at the first error from fn.
+func (sh S3Handler) walkObjects(bucket string, prefix string, fn func(key string, size int64, modified time.Time) error) error {
+	log.Debugf("walkObjects %s %s", bucket, prefix)
+
+	var fnErr error
+	input := s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	err := sh.client.ListObjectsV2Pages(&input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if fnErr = fn(aws.StringValue(obj.Key), aws.Int64Value(obj.Size), aws.TimeValue(obj.LastModified)); fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
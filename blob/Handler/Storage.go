@@ -0,0 +1,132 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"io"
+)
+
+// BlobService is the part of the blob storage client that BlobHandler uses.
+// Real one wraps storage.BlobStorageClient, MemoryBlobService is an in-memory fake.
+type BlobService interface {
+	GetContainerReference(name string) Container
+	ListContainers(params storage.ListContainersParameters) (*storage.ContainerListResponse, error)
+}
+
+// Container is the part of storage.Container that BlobHandler uses.
+type Container interface {
+	Exists() (bool, error)
+	CreateIfNotExists(options *storage.CreateContainerOptions) (bool, error)
+	ListBlobs(params storage.ListBlobsParameters) (storage.BlobListResponse, error)
+	GetBlobReference(name string) Blob
+	GetURL() string
+}
+
+// Blob is the part of storage.Blob that BlobHandler uses.
+// Properties are only populated once GetProperties has been called. Any changes made to them
+// (content type etc) are sent when the block list is put.
+type Blob interface {
+	Name() string
+	Properties() *storage.BlobProperties
+	GetURL() string
+
+	GetProperties(options *storage.GetBlobPropertiesOptions) error
+	Get(options *storage.GetBlobOptions) (io.ReadCloser, error)
+	GetRange(options *storage.GetBlobRangeOptions) (io.ReadCloser, error)
+	Delete(options *storage.DeleteBlobOptions) error
+
+	PutBlock(blockID string, chunk []byte, options *storage.PutBlockOptions) error
+	PutBlockList(blocks []storage.Block, options *storage.PutBlockListOptions) error
+	GetBlockList(blockType storage.BlockListType, options *storage.GetBlockListOptions) (storage.BlockListResponse, error)
+
+	StartCopy(sourceBlob string, options *storage.CopyOptions) (string, error)
+	AbortCopy(copyID string, options *storage.AbortCopyOptions) error
+}
+
+// azureBlobService is the BlobService backed by Azure.
+type azureBlobService struct {
+	client storage.BlobStorageClient
+}
+
+func (s azureBlobService) GetContainerReference(name string) Container {
+	return azureContainer{container: s.client.GetContainerReference(name)}
+}
+
+func (s azureBlobService) ListContainers(params storage.ListContainersParameters) (*storage.ContainerListResponse, error) {
+	return s.client.ListContainers(params)
+}
+
+type azureContainer struct {
+	container *storage.Container
+}
+
+func (c azureContainer) Exists() (bool, error) {
+	return c.container.Exists()
+}
+
+func (c azureContainer) CreateIfNotExists(options *storage.CreateContainerOptions) (bool, error) {
+	return c.container.CreateIfNotExists(options)
+}
+
+func (c azureContainer) ListBlobs(params storage.ListBlobsParameters) (storage.BlobListResponse, error) {
+	return c.container.ListBlobs(params)
+}
+
+func (c azureContainer) GetBlobReference(name string) Blob {
+	return azureBlob{blob: c.container.GetBlobReference(name)}
+}
+
+func (c azureContainer) GetURL() string {
+	return c.container.GetURL()
+}
+
+type azureBlob struct {
+	blob *storage.Blob
+}
+
+func (b azureBlob) Name() string {
+	return b.blob.Name
+}
+
+func (b azureBlob) Properties() *storage.BlobProperties {
+	return &b.blob.Properties
+}
+
+func (b azureBlob) GetURL() string {
+	return b.blob.GetURL()
+}
+
+func (b azureBlob) GetProperties(options *storage.GetBlobPropertiesOptions) error {
+	return b.blob.GetProperties(options)
+}
+
+func (b azureBlob) Get(options *storage.GetBlobOptions) (io.ReadCloser, error) {
+	return b.blob.Get(options)
+}
+
+func (b azureBlob) GetRange(options *storage.GetBlobRangeOptions) (io.ReadCloser, error) {
+	return b.blob.GetRange(options)
+}
+
+func (b azureBlob) Delete(options *storage.DeleteBlobOptions) error {
+	return b.blob.Delete(options)
+}
+
+func (b azureBlob) PutBlock(blockID string, chunk []byte, options *storage.PutBlockOptions) error {
+	return b.blob.PutBlock(blockID, chunk, options)
+}
+
+func (b azureBlob) PutBlockList(blocks []storage.Block, options *storage.PutBlockListOptions) error {
+	return b.blob.PutBlockList(blocks, options)
+}
+
+func (b azureBlob) GetBlockList(blockType storage.BlockListType, options *storage.GetBlockListOptions) (storage.BlockListResponse, error) {
+	return b.blob.GetBlockList(blockType, options)
+}
+
+func (b azureBlob) StartCopy(sourceBlob string, options *storage.CopyOptions) (string, error) {
+	return b.blob.StartCopy(sourceBlob, options)
+}
+
+func (b azureBlob) AbortCopy(copyID string, options *storage.AbortCopyOptions) error {
+	return b.blob.AbortCopy(copyID, options)
+}
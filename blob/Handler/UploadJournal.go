@@ -0,0 +1,161 @@
+package Handler
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// journalHeader identifies the upload a journal belongs to.
+// If the local file changes (size/modtime) or the block size differs then the journal is useless.
+type journalHeader struct {
+	LocalFile string
+	Container string
+	BlobName  string
+	Size      int64
+	ModTime   time.Time
+	BlockSize int64
+}
+
+// uploadJournal records (on disk) the offsets of the blocks that have been put for a file.
+// First line is the JSON header, then one line per uploaded block offset.
+// The journal is removed once the block list is committed.
+type uploadJournal struct {
+	path    string
+	file    *os.File
+	lock    sync.Mutex
+	resumed bool
+	offsets map[int64]bool
+}
+
+// openUploadJournal opens the journal for the upload described by header.
+// If resume is set and an existing journal matches the header, the previously recorded offsets are loaded
+// and new offsets are appended. Otherwise the journal is started from scratch.
+func openUploadJournal(journalDir string, header journalHeader, resume bool) (*uploadJournal, error) {
+	if err := os.MkdirAll(journalDir, 0700); err != nil {
+		return nil, err
+	}
+
+	j := uploadJournal{
+		path:    filepath.Join(journalDir, journalName(header)),
+		offsets: make(map[int64]bool),
+	}
+
+	if resume {
+		resumed, err := j.load(header)
+		if err != nil {
+			log.Debugf("unable to load journal %s, starting again: %s", j.path, err)
+		}
+		j.resumed = resumed
+	}
+
+	if j.resumed {
+		file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		j.file = file
+		return &j, nil
+	}
+
+	j.offsets = make(map[int64]bool)
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		j.close()
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintf(j.file, "%s\n", headerJSON); err != nil {
+		j.close()
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// journalName is unique per local file and destination blob.
+func journalName(header journalHeader) string {
+	h := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s", header.LocalFile, header.Container, header.BlobName)))
+	return hex.EncodeToString(h[:]) + ".journal"
+}
+
+// load reads an existing journal. Returns false if there isn't one or it's for a different version of the file.
+func (j *uploadJournal) load(header journalHeader) (bool, error) {
+	file, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return false, scanner.Err()
+	}
+
+	existing := journalHeader{}
+	if err := json.Unmarshal(scanner.Bytes(), &existing); err != nil {
+		return false, err
+	}
+
+	if existing.Size != header.Size || !existing.ModTime.Equal(header.ModTime) || existing.BlockSize != header.BlockSize {
+		log.Debugf("journal %s is for a different version of %s", j.path, header.LocalFile)
+		return false, nil
+	}
+
+	for scanner.Scan() {
+		offset, err := strconv.ParseInt(scanner.Text(), 10, 64)
+		if err != nil {
+			// probably a partial line from when we were interrupted.
+			log.Debugf("ignoring journal entry %s", scanner.Text())
+			continue
+		}
+		j.offsets[offset] = true
+	}
+
+	return true, scanner.Err()
+}
+
+// uploaded returns true if the block at offset was recorded by a previous run.
+func (j *uploadJournal) uploaded(offset int64) bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.offsets[offset]
+}
+
+// record appends the offset of a block that has been put.
+func (j *uploadJournal) record(offset int64) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.offsets[offset] = true
+	_, err := fmt.Fprintf(j.file, "%d\n", offset)
+	return err
+}
+
+func (j *uploadJournal) close() {
+	j.file.Close()
+}
+
+// remove closes and deletes the journal, called once the upload is complete.
+func (j *uploadJournal) remove() error {
+	j.close()
+	return os.Remove(j.path)
+}
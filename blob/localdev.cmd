@@ -1,3 +1 @@
-set ACCOUNT_NAME=devstoreaccount1
-set ACCOUNT_KEY=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==
-
+set USE_EMULATOR=true
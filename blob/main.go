@@ -1,208 +1,26 @@
 package main
 
 import (
-	"azurestoragetools/blob/Handler"
-	"azurestoragetools/common"
-	"flag"
+	"azurestoragetools/blob/Command"
 	"fmt"
 	"os"
-	"strconv"
-
-	log "github.com/Sirupsen/logrus"
 )
 
 var Version string
 
-// getCommand. Naive way to determine what the actual user wants to do. Copy, list etc etc.
-// rework when it gets more complex.
-func getCommand(uploadCommand bool, downloadCommand bool, listCommand bool, createContainerCommand bool, listContainersCommand bool, blobSASURLCommand bool, containerSASURLCommand bool) int {
-
-	if !uploadCommand && !downloadCommand && !listCommand && !createContainerCommand && !listContainersCommand && !blobSASURLCommand && !containerSASURLCommand {
-		fmt.Println("No command given")
-		os.Exit(1)
-	}
-
-	if blobSASURLCommand {
-		return common.CommandSASURLBlob
-	}
-
-	if containerSASURLCommand {
-		return common.CommandSASURLContainer
-	}
-
-	if listContainersCommand {
-		return common.CommandListContainers
-	}
-
-	if uploadCommand {
-		return common.CommandUpload
-	}
-
-	if downloadCommand {
-		return common.CommandDownload
-	}
-
-	if listCommand {
-		return common.CommandListBlobs
-	}
-
-	if createContainerCommand {
-		return common.CommandCreateContainer
-	}
-
-	log.Fatal("unsure of command to use")
-	return common.CommandUnknown
-}
-
-func setupConfiguration() *common.CloudConfig {
-	config := common.NewCloudConfig()
-
-	var concurrentCount = flag.Uint("cc", 5, "Concurrent Count. How many blobs are copied concurrently")
-
-	var version = flag.Bool("version", false, "Display Version")
-	var localFilesystem = flag.String("local", "", "Path for local filesystem")
-	var debug = flag.Bool("debug", false, "Debug output")
-	var upload = flag.Bool("upload", false, "Upload from local filesystem to Azure")
-	var download = flag.Bool("download", false, "Download to local filesystem from Azure")
-	var listCommand = flag.Bool("list", false, "List blobs in container")
-	var listContainersCommand = flag.Bool("listcontainers", false, "List available containers")
-	var createContainerCommand = flag.Bool("createcontainer", false, "Create container for Azure")
-	var generateBlobSASCommand = flag.Bool("blobsas", false, "Generate Blob SAS URL")
-	//var generateContainerSASCommand = flag.Bool("containersas", false, "Generate Container SAS URL")
-	//var generateBlobSASCommand = false
-	var generateContainerSASCommand = false
-
-	var containerName = flag.String("container", "", "Container used for command")
-	var blobPrefix = flag.String("blobprefix", "", "Optional: BlobPrefix for download command. This can either be entire blob name or just a prefix.")
-	var timeout = flag.String("sastimeout", "", "Optional: Timeout in seconds for generating SAS URL. Defaults to 60 seconds.")
-	var perms = flag.String("sasperms", "", "Optional: SAS permissions. Combination of rw")
-
-	var azureDefaultAccountName = flag.String("AzureDefaultAccountName", "", "Default Azure Account Name")
-	var azureDefaultAccountKey = flag.String("AzureDefaultAccountKey", "", "Default Azure Account Key")
-	flag.Parse()
-
-	config.Version = *version
-	config.Debug = *debug
-	if !*version {
-
-		if *concurrentCount > 1000 {
-			fmt.Printf("Maximum number for concurrent count is 1000")
-			os.Exit(1)
-		}
-
-		config.Command = getCommand(*upload, *download, *listCommand, *createContainerCommand, *listContainersCommand, *generateBlobSASCommand, generateContainerSASCommand)
-		config.Configuration[common.Local] = *localFilesystem
-		config.Configuration[common.Container] = *containerName
-		config.Configuration[common.BlobPrefix] = *blobPrefix
-		config.Configuration[common.Timeout] = *timeout
-		config.Configuration[common.SASPermissions] = *perms
-		config.ConcurrentCount = *concurrentCount
-
-		config.Configuration[common.AzureDefaultAccountName] = os.Getenv("ACCOUNT_NAME")
-		config.Configuration[common.AzureDefaultAccountKey] = os.Getenv("ACCOUNT_KEY")
-
-		// passed params trumps env vars.
-		if *azureDefaultAccountName != "" {
-			config.Configuration[common.AzureDefaultAccountName] = *azureDefaultAccountName
-		}
-
-		if *azureDefaultAccountKey != "" {
-			config.Configuration[common.AzureDefaultAccountKey] = *azureDefaultAccountKey
-		}
-
-	}
-
-	return config
-}
-
-// "so it begins"
+// astblob is "ast blob". The original "astblob -upload -container temp" style still works.
 func main() {
-
-	config := setupConfiguration()
-
-	if !config.Debug {
-		log.SetLevel(log.InfoLevel)
-	} else {
-		log.SetLevel(log.DebugLevel)
-	}
-	log.Debug("after config setup")
-
-	// if display version, then display then exit
-	if config.Version {
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "-version" || args[0] == "version") {
 		fmt.Println("Version: " + Version)
 		return
 	}
 
-	bh, err := Handler.NewBlobHandler(config.Configuration[common.AzureDefaultAccountName], config.Configuration[common.AzureDefaultAccountKey], 5)
+	args, err := Command.Tool.LegacyArgs(args)
 	if err != nil {
-		log.Debugf("Unable to create BlobHandler")
-		return
-	}
-
-	switch config.Command {
-	case common.CommandUpload:
-		err := bh.UploadFiles(config.Configuration[common.Local], config.Configuration[common.Container])
-		if err != nil {
-			log.Fatal(err)
-		}
-		break
-
-	case common.CommandDownload:
-		err := bh.DownloadFiles(config.Configuration[common.Container], config.Configuration[common.BlobPrefix], config.Configuration[common.Local])
-		if err != nil {
-			log.Fatal(err)
-		}
-		break
-
-	case common.CommandSASURLBlob:
-		timeout, _ := strconv.Atoi(config.Configuration[common.Timeout])
-		url, err := bh.GenerateSASURLForBlob(config.Configuration[common.Container], config.Configuration[common.BlobPrefix], timeout, config.Configuration[common.SASPermissions])
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		fmt.Printf("SAS URL %s", url)
-		break
-
-	case common.CommandSASURLContainer:
-		timeout, _ := strconv.Atoi(config.Configuration[common.Timeout])
-		url, err := bh.GenerateSASURLForContainer(config.Configuration[common.Container], timeout)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fmt.Printf("SAS URL %s", url)
-		break
-
-	case common.CommandListBlobs:
-		blobList, err := bh.ListBlobsInContainer(config.Configuration[common.Container])
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, b := range blobList {
-			fmt.Printf("%s\n", b.Name)
-		}
-		break
-
-	case common.CommandListContainers:
-		containerList, err := bh.ListContainers()
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		for _, c := range containerList {
-			fmt.Printf("%s\n", c.Name)
-		}
-		break
-
-	case common.CommandCreateContainer:
-		err := bh.CreateContainer(config.Configuration[common.Container])
-		if err != nil {
-			log.Fatal(err)
-		}
-
-	case common.CommandUnknown:
-		log.Fatal("Unsure of command to execute")
+		fmt.Println(err)
+		os.Exit(2)
 	}
 
+	os.Exit(Command.Tool.Main("astblob", args))
 }
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"azure-sdk-for-go/storage"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// description of each SAS permission, used in errors.
+var sasPermissionNames = map[byte]string{
+	'r': "read",
+	'a': "add",
+	'c': "create",
+	'w': "write",
+	'd': "delete",
+	'l': "list",
+	'u': "update",
+	'p': "process",
+}
+
+// Account is the storage account being used and how we authenticate against it.
+// Either Key or SASToken is set. With only a SAS token nothing can be signed (no SAS generation)
+// and every operation is limited to what the token allows.
+type Account struct {
+	Name     string
+	Key      string
+	SASToken string // without the leading ?
+	Endpoint Endpoint
+}
+
+// NewAccount creates the account for the name and key/SAS token. The emulator only has the one well known account.
+func NewAccount(name string, key string, sasToken string, endpoint Endpoint) Account {
+	if endpoint.Emulator {
+		return Account{Name: storage.StorageEmulatorAccountName, Key: storage.StorageEmulatorAccountKey, Endpoint: endpoint}
+	}
+
+	return Account{Name: name, Key: key, SASToken: strings.TrimPrefix(sasToken, "?"), Endpoint: endpoint}
+}
+
+// ParseConnectionString converts an Azure storage connection string into an Account.
+// eg DefaultEndpointsProtocol=https;AccountName=myaccount;AccountKey=mykey;EndpointSuffix=core.windows.net
+// SharedAccessSignature can be given instead of AccountKey, and BlobEndpoint/QueueEndpoint/TableEndpoint
+// instead of AccountName. UseDevelopmentStorage=true is the emulator.
+func ParseConnectionString(connectionString string) (Account, error) {
+	values := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return Account{}, fmt.Errorf("Invalid connection string, %s isn't key=value", part)
+		}
+		values[strings.ToLower(kv[0])] = kv[1]
+	}
+
+	if strings.ToLower(values["usedevelopmentstorage"]) == "true" {
+		return NewAccount("", "", "", Endpoint{Emulator: true}), nil
+	}
+
+	endpoint := DefaultEndpoint()
+	if values["endpointsuffix"] != "" {
+		endpoint.BaseURL = values["endpointsuffix"]
+	}
+	if strings.ToLower(values["defaultendpointsprotocol"]) == "http" {
+		endpoint.UseHTTPS = false
+	}
+
+	accountName := values["accountname"]
+
+	// explicit service endpoints, eg https://myaccount.blob.core.windows.net
+	for _, key := range []string{"blobendpoint", "queueendpoint", "tableendpoint"} {
+		if values[key] == "" {
+			continue
+		}
+
+		name, serviceEndpoint, err := parseServiceURL(values[key])
+		if err != nil {
+			return Account{}, err
+		}
+
+		if accountName != "" && accountName != name {
+			return Account{}, fmt.Errorf("Invalid connection string, %s is for account %s not %s", values[key], name, accountName)
+		}
+		accountName = name
+		endpoint = serviceEndpoint
+	}
+
+	if accountName == "" {
+		return Account{}, errors.New("Invalid connection string, no AccountName or service endpoint")
+	}
+
+	if values["accountkey"] == "" && values["sharedaccesssignature"] == "" {
+		return Account{}, errors.New("Invalid connection string, requires AccountKey or SharedAccessSignature")
+	}
+
+	return NewAccount(accountName, values["accountkey"], values["sharedaccesssignature"], endpoint), nil
+}
+
+// parseServiceURL splits a service URL (scheme://account.service.baseurl) into the account name and endpoint.
+func parseServiceURL(serviceURL string) (string, Endpoint, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return "", Endpoint{}, err
+	}
+
+	parts := strings.SplitN(u.Host, ".", 3)
+	if len(parts) != 3 || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", Endpoint{}, fmt.Errorf("Unsupported service endpoint %s, expected scheme://account.service.baseurl", serviceURL)
+	}
+
+	return parts[0], Endpoint{BaseURL: parts[2], UseHTTPS: u.Scheme == "https"}, nil
+}
+
+// AccountFromConfig works out the default account from the config.
+// A connection string (-connectionstring or AZURE_STORAGE_CONNECTION_STRING) is used if given,
+// otherwise the account name with either the key or SAS token, at the -endpoint/-emulator endpoint.
+func AccountFromConfig(config *CloudConfig) (Account, error) {
+	if config.Configuration[ConnectionString] != "" {
+		return ParseConnectionString(config.Configuration[ConnectionString])
+	}
+
+	return AccountFromConfigKeys(config, AzureDefaultAccountName, AzureDefaultAccountKey)
+}
+
+// AccountFromConfigKeys creates the account using the name/key in the given config keys (eg source/dest for copy).
+func AccountFromConfigKeys(config *CloudConfig, accountNameKey string, accountKeyKey string) (Account, error) {
+	endpoint, err := EndpointFromFlags(config.Configuration[StorageEndpoint], config.Emulator)
+	if err != nil {
+		return Account{}, err
+	}
+
+	account := NewAccount(config.Configuration[accountNameKey], config.Configuration[accountKeyKey], "", endpoint)
+	if account.Key == "" && accountNameKey == AzureDefaultAccountName {
+		account.SASToken = strings.TrimPrefix(config.Configuration[SASToken], "?")
+	}
+
+	if account.Name == "" {
+		return Account{}, errors.New("No account given. Use ACCOUNT_NAME (or -AzureDefaultAccountName), a connection string or -emulator")
+	}
+
+	if account.Key == "" && account.SASToken == "" {
+		return Account{}, fmt.Errorf("No key or SAS token given for account %s", account.Name)
+	}
+
+	return account, nil
+}
+
+// NewStorageClient creates the SDK client for the account, authenticated with the key or SAS token.
+func (a Account) NewStorageClient() (storage.Client, error) {
+	if a.Endpoint.Emulator {
+		return storage.NewEmulatorClient()
+	}
+
+	if a.Key == "" {
+		// the SAS client works out the base URL from the service URL, which service doesn't matter.
+		return storage.NewAccountSASClientFromEndpointToken(a.Endpoint.ServiceURL(a.Name, "blob"), a.SASToken)
+	}
+
+	return storage.NewClient(a.Name, a.Key, a.Endpoint.BaseURL, storage.DefaultAPIVersion, a.Endpoint.UseHTTPS)
+}
+
+// CheckSASPermissions returns an error listing any of the required permissions (eg "rl") that the SAS token doesn't grant.
+// Always fine when using the account key. action is used in the error, eg "upload".
+func (a Account) CheckSASPermissions(required string, action string) error {
+	if a.Key != "" {
+		return nil
+	}
+
+	values, err := url.ParseQuery(a.SASToken)
+	if err != nil {
+		return fmt.Errorf("Invalid SAS token: %s", err)
+	}
+
+	granted := values.Get("sp")
+	missing := []string{}
+	for i := 0; i < len(required); i++ {
+		if !strings.ContainsRune(granted, rune(required[i])) {
+			missing = append(missing, fmt.Sprintf("%c (%s)", required[i], sasPermissionNames[required[i]]))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("SAS token doesn't allow %s, it is missing permission %s. Token has permissions %s", action, strings.Join(missing, ", "), granted)
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// errUsageShown is returned when flag parsing fails, the flag package has already shown the error and usage.
+var errUsageShown = errors.New("usage shown")
+
+// Flags registers a subcommand's flags and, once parsed, copies them into the CloudConfig.
+// Flags trump env vars, both trump the profile.
+type Flags struct {
+	fs     *flag.FlagSet
+	config *CloudConfig
+	apply  []func()
+}
+
+func newFlags(name string, config *CloudConfig) *Flags {
+	return &Flags{fs: flag.NewFlagSet(name, flag.ContinueOnError), config: config}
+}
+
+// String adds a string flag stored in the config key. If env is given that env var is used when the flag isn't.
+func (f *Flags) String(key string, name string, env string, usage string) {
+	v := f.fs.String(name, "", usage)
+	f.apply = append(f.apply, func() {
+		f.config.Configuration[key] = *v
+		if env != "" {
+			f.config.Configuration[key] = FirstSet(*v, os.Getenv(env))
+		}
+	})
+}
+
+// StringDefault adds a string flag, with a default, stored in the config key.
+func (f *Flags) StringDefault(key string, name string, value string, usage string) {
+	v := f.fs.String(name, value, usage)
+	f.apply = append(f.apply, func() {
+		f.config.Configuration[key] = *v
+	})
+}
+
+// Strings adds a repeatable string flag stored in the config key, one value per line (see SplitList).
+func (f *Flags) Strings(key string, name string, usage string) {
+	var v listValue
+	f.fs.Var(&v, name, usage)
+	f.apply = append(f.apply, func() {
+		f.config.Configuration[key] = strings.Join(v, "\n")
+	})
+}
+
+// listValue collects every value of a repeatable flag.
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// SplitList splits the values of a repeatable flag.
+func SplitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, "\n")
+}
+
+// Bool adds a bool flag stored in target (one of the CloudConfig fields).
+func (f *Flags) Bool(target *bool, name string, usage string) {
+	f.fs.BoolVar(target, name, false, usage)
+}
+
+// BoolString adds a bool flag stored in the config key as "true" or "false". The key is only set if the flag is given,
+// so (like the string flags) the profile is used otherwise and -name=false can turn off the profile's setting.
+func (f *Flags) BoolString(key string, name string, usage string) {
+	v := f.fs.Bool(name, false, usage)
+	f.apply = append(f.apply, func() {
+		f.fs.Visit(func(fl *flag.Flag) {
+			if fl.Name == name {
+				f.config.Configuration[key] = strconv.FormatBool(*v)
+			}
+		})
+	})
+}
+
+// Uint adds a uint flag stored in target (one of the CloudConfig fields).
+func (f *Flags) Uint(target *uint, name string, usage string) {
+	f.fs.UintVar(target, name, 0, usage)
+}
+
+// Config is the CloudConfig the flags are stored in. eg for Bool flags.
+func (f *Flags) Config() *CloudConfig {
+	return f.config
+}
+
+// AccountFlags are the flags every command has for picking the account.
+func (f *Flags) AccountFlags() {
+	f.Bool(&f.config.Debug, "debug", "Debug output")
+	f.String(ProfileName, "profile", "", "Optional: Profile from the config file (~/.ast/config.yaml) to use. Defaults to AST_PROFILE or the config file's default")
+	f.String(AzureDefaultAccountName, "AzureDefaultAccountName", "ACCOUNT_NAME", "Default Azure Account Name")
+	f.String(AzureDefaultAccountKey, "AzureDefaultAccountKey", "ACCOUNT_KEY", "Default Azure Account Key")
+	f.String(ConnectionString, "connectionstring", "AZURE_STORAGE_CONNECTION_STRING", "Optional: Azure storage connection string, used instead of account name and key")
+	f.String(SASToken, "sastoken", "AZURE_STORAGE_SAS_TOKEN", "Optional: SAS token used instead of the account key. Commands are limited to what the token allows")
+	f.String(StorageEndpoint, "endpoint", "", "Optional: Azure cloud (public, china, usgovernment, germany) or base URL (eg core.windows.net, http://mystorage.local) for the account")
+	f.Bool(&f.config.Emulator, "emulator", "Optional: Use the local storage emulator (Azurite) and its well known account")
+	f.Bool(&f.config.DryRun, "dryrun", "Optional: Only print what would be created, overwritten or deleted. Nothing is changed")
+}
+
+// SASFlags are the flags for generating SAS URLs. permissions describes the allowed permissions.
+func (f *Flags) SASFlags(permissions string) {
+	f.String(SASTimeout, "sastimeout", "", "Optional: Timeout in seconds for generating SAS URL. Defaults to 60 seconds (none with -sasid)")
+	f.String(SASPermissions, "sasperms", "", "Optional: SAS permissions. Combination of "+permissions+". Defaults to r (none with -sasid)")
+	f.String(SASIPRange, "sasip", "", "Optional: IP address or range (eg 168.1.5.60-168.1.5.70) allowed to use SAS URL")
+	f.BoolString(SASHTTPSOnly, "sashttps", "Optional: Only allow SAS URL to be used over HTTPS (-sashttps=false allows http even if the profile sets sashttps)")
+	f.String(SASIdentifier, "sasid", "", "Optional: Stored access policy identifier for SAS URL. Timeout and permissions then come from the stored policy unless given")
+}
+
+// Subcommand is a single command of a tool, eg upload in "ast blob upload".
+type Subcommand struct {
+	Name    string
+	Command int // one of the Command* consts
+	Summary string
+
+	// Flags registers the flags the subcommand uses.
+	Flags func(f *Flags)
+}
+
+// Tool is one of blob, queue or table along with its subcommands.
+type Tool struct {
+	Name        string
+	Summary     string
+	Subcommands []Subcommand
+
+	// Run validates the configuration and runs the command.
+	Run func(config *CloudConfig) error
+}
+
+// Subcommand finds the subcommand by name.
+func (t Tool) Subcommand(name string) (Subcommand, bool) {
+	for _, sub := range t.Subcommands {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return Subcommand{}, false
+}
+
+// FlagNames are the flags of the subcommand, used for shell completion.
+func (t Tool) FlagNames(sub Subcommand) []string {
+	f := newFlags(sub.Name, NewCloudConfig())
+	sub.Flags(f)
+
+	names := []string{}
+	f.fs.VisitAll(func(fl *flag.Flag) {
+		names = append(names, "-"+fl.Name)
+	})
+	return names
+}
+
+// Parse parses the subcommand's args into a CloudConfig. Flags, then env vars, then the profile.
+func (t Tool) Parse(prog string, sub Subcommand, args []string) (*CloudConfig, error) {
+	config := NewCloudConfig()
+	config.Command = sub.Command
+
+	f := newFlags(prog, config)
+	sub.Flags(f)
+	f.fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n\n%s\n\nFlags:\n", prog, sub.Summary)
+		f.fs.PrintDefaults()
+	}
+
+	if err := f.fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil, err
+		}
+		return nil, errUsageShown
+	}
+
+	if f.fs.NArg() > 0 {
+		return nil, fmt.Errorf("Unexpected argument %s, see %s -h", f.fs.Arg(0), prog)
+	}
+
+	for _, apply := range f.apply {
+		apply()
+	}
+
+	// anything not given as a flag or env var comes from the profile.
+	profile, err := LoadProfile(config.Configuration[ProfileName])
+	if err != nil {
+		return nil, err
+	}
+	ApplyProfile(config, profile)
+
+	return config, nil
+}
+
+// Usage lists the subcommands.
+func (t Tool) Usage(prog string, w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\n%s\n", prog, t.Summary)
+	if len(t.Subcommands) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nCommands:\n")
+	for _, sub := range t.Subcommands {
+		fmt.Fprintf(w, "  %-16s %s\n", sub.Name, sub.Summary)
+	}
+	fmt.Fprintf(w, "\nUse \"%s <command> -h\" for the flags of a command.\n", prog)
+}
+
+// Main runs "prog <command> [flags]" and returns the exit code.
+func (t Tool) Main(prog string, args []string) int {
+	if len(args) == 0 {
+		t.Usage(prog, os.Stderr)
+		return 2
+	}
+
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		t.Usage(prog, os.Stdout)
+		return 0
+	}
+
+	sub, ok := t.Subcommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n\n", args[0])
+		t.Usage(prog, os.Stderr)
+		return 2
+	}
+
+	config, err := t.Parse(prog+" "+sub.Name, sub, args[1:])
+	if err == flag.ErrHelp {
+		return 0
+	}
+
+	if err == errUsageShown {
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if !config.Debug {
+		log.SetLevel(log.InfoLevel)
+	} else {
+		log.SetLevel(log.DebugLevel)
+	}
+	log.Debug("after config setup")
+
+	if err := t.Run(config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// LegacyArgs converts the original "-upload -container temp" style into "upload -container temp",
+// so astblob/astqueue keep working as before. Exactly one command flag must be given.
+// Args already in subcommand style are returned unchanged.
+func (t Tool) LegacyArgs(args []string) ([]string, error) {
+	if len(args) == 0 || !strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		return args, nil
+	}
+
+	commands := []string{}
+	rest := []string{}
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		name = strings.TrimSuffix(name, "=true")
+		if _, ok := t.Subcommand(name); ok && strings.HasPrefix(arg, "-") {
+			commands = append(commands, name)
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("No command given")
+	}
+
+	if len(commands) > 1 {
+		return nil, fmt.Errorf("Only one command can be given, got -%s", strings.Join(commands, " and -"))
+	}
+
+	return append([]string{commands[0]}, rest...), nil
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// CompletionScript generates the shell completion script for prog (eg ast) and its tools.
+// shell is one of bash, zsh or fish.
+func CompletionScript(shell string, prog string, tools []Tool) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion(prog, tools), nil
+	case "zsh":
+		// zsh can use the bash completion as is.
+		return "autoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(prog, tools), nil
+	case "fish":
+		return fishCompletion(prog, tools), nil
+	}
+
+	return "", fmt.Errorf("Unsupported shell %s, should be one of bash, zsh, fish", shell)
+}
+
+func toolNames(tools []Tool) []string {
+	names := []string{}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func subcommandNames(tool Tool) []string {
+	names := []string{}
+	for _, sub := range tool.Subcommands {
+		names = append(names, sub.Name)
+	}
+	return names
+}
+
+func bashCompletion(prog string, tools []Tool) string {
+	fn := "_" + prog + "_completion"
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	fmt.Fprintf(&b, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(&b, "    local words=\"\"\n")
+	fmt.Fprintf(&b, "    if [ $COMP_CWORD -eq 1 ]; then\n")
+	fmt.Fprintf(&b, "        words=\"%s help version completion\"\n", strings.Join(toolNames(tools), " "))
+	fmt.Fprintf(&b, "    elif [ $COMP_CWORD -eq 2 ]; then\n")
+	fmt.Fprintf(&b, "        case \"${COMP_WORDS[1]}\" in\n")
+	for _, tool := range tools {
+		fmt.Fprintf(&b, "            %s) words=\"%s\" ;;\n", tool.Name, strings.Join(subcommandNames(tool), " "))
+	}
+	fmt.Fprintf(&b, "            completion) words=\"bash zsh fish\" ;;\n")
+	fmt.Fprintf(&b, "        esac\n")
+	fmt.Fprintf(&b, "    else\n")
+	fmt.Fprintf(&b, "        case \"${COMP_WORDS[1]} ${COMP_WORDS[2]}\" in\n")
+	for _, tool := range tools {
+		for _, sub := range tool.Subcommands {
+			fmt.Fprintf(&b, "            \"%s %s\") words=\"%s\" ;;\n", tool.Name, sub.Name, strings.Join(tool.FlagNames(sub), " "))
+		}
+	}
+	fmt.Fprintf(&b, "        esac\n")
+	fmt.Fprintf(&b, "    fi\n")
+	fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, "complete -o default -F %s %s\n", fn, prog)
+
+	return b.String()
+}
+
+func fishCompletion(prog string, tools []Tool) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "complete -c %s -f -n '__fish_use_subcommand' -a 'help version'\n", prog)
+	fmt.Fprintf(&b, "complete -c %s -f -n '__fish_use_subcommand' -a 'completion' -d 'Generate shell completion'\n", prog)
+	fmt.Fprintf(&b, "complete -c %s -f -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n", prog)
+
+	for _, tool := range tools {
+		fmt.Fprintf(&b, "complete -c %s -f -n '__fish_use_subcommand' -a '%s' -d '%s'\n", prog, tool.Name, fishQuote(tool.Summary))
+
+		for _, sub := range tool.Subcommands {
+			fmt.Fprintf(&b, "complete -c %s -f -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a '%s' -d '%s'\n",
+				prog, tool.Name, strings.Join(subcommandNames(tool), " "), sub.Name, fishQuote(sub.Summary))
+
+			// fish completes single dash long flags with -o
+			for _, name := range tool.FlagNames(sub) {
+				fmt.Fprintf(&b, "complete -c %s -n '__fish_seen_subcommand_from %s; and __fish_seen_subcommand_from %s' -o '%s'\n",
+					prog, tool.Name, sub.Name, strings.TrimPrefix(name, "-"))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// fishQuote escapes s for use inside single quotes.
+func fishQuote(s string) string {
+	return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `'`, `\'`, -1)
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"azure-sdk-for-go/storage"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// base URLs (domain suffix after account.service.) for each Azure cloud.
+var cloudBaseURLs = map[string]string{
+	"public":       storage.DefaultBaseURL,
+	"china":        "core.chinacloudapi.cn",
+	"usgovernment": "core.usgovcloudapi.net",
+	"germany":      "core.cloudapi.de",
+}
+
+// emulator (Azurite) hosts for each service.
+var emulatorHosts = map[string]string{
+	"blob":  "127.0.0.1:10000",
+	"queue": "127.0.0.1:10001",
+	"table": "127.0.0.1:10002",
+}
+
+// Endpoint is where the storage account lives. Public cloud, sovereign cloud, custom base URL or the local emulator.
+type Endpoint struct {
+	BaseURL  string // eg core.windows.net, services are at account.blob.BaseURL etc
+	UseHTTPS bool
+	Emulator bool
+}
+
+// DefaultEndpoint is the public Azure cloud over https.
+func DefaultEndpoint() Endpoint {
+	return Endpoint{BaseURL: storage.DefaultBaseURL, UseHTTPS: true}
+}
+
+// ParseEndpoint converts the -endpoint value into an Endpoint.
+// endpoint can be a cloud name (public, china, usgovernment, germany), or a base URL optionally
+// starting with http:// or https:// (defaults to https). Empty means public cloud.
+// If emulator is set then endpoint is ignored.
+func ParseEndpoint(endpoint string, emulator bool) (Endpoint, error) {
+	if emulator {
+		return Endpoint{Emulator: true}, nil
+	}
+
+	if endpoint == "" {
+		return DefaultEndpoint(), nil
+	}
+
+	if baseURL, ok := cloudBaseURLs[strings.ToLower(endpoint)]; ok {
+		return Endpoint{BaseURL: baseURL, UseHTTPS: true}, nil
+	}
+
+	e := Endpoint{BaseURL: endpoint, UseHTTPS: true}
+	if strings.HasPrefix(endpoint, "http://") {
+		e.BaseURL = strings.TrimPrefix(endpoint, "http://")
+		e.UseHTTPS = false
+	} else if strings.HasPrefix(endpoint, "https://") {
+		e.BaseURL = strings.TrimPrefix(endpoint, "https://")
+	}
+
+	e.BaseURL = strings.TrimSuffix(e.BaseURL, "/")
+	if e.BaseURL == "" || strings.Contains(e.BaseURL, "/") {
+		return Endpoint{}, fmt.Errorf("Invalid endpoint %s, should be a cloud name (public, china, usgovernment, germany) or base URL such as core.windows.net", endpoint)
+	}
+
+	return e, nil
+}
+
+// EndpointFromFlags works out the endpoint from the -endpoint and -emulator flags.
+// Flags trump env vars, which are STORAGE_ENDPOINT and USE_EMULATOR.
+func EndpointFromFlags(endpointFlag string, emulatorFlag bool) (Endpoint, error) {
+	endpoint := os.Getenv("STORAGE_ENDPOINT")
+	if endpointFlag != "" {
+		endpoint = endpointFlag
+	}
+
+	emulator := emulatorFlag
+	if !emulator && endpointFlag == "" && os.Getenv("USE_EMULATOR") != "" {
+		useEmulator, err := strconv.ParseBool(os.Getenv("USE_EMULATOR"))
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("Invalid USE_EMULATOR value %s", os.Getenv("USE_EMULATOR"))
+		}
+		emulator = useEmulator
+	}
+
+	return ParseEndpoint(endpoint, emulator)
+}
+
+// ServiceURL is the URL of the service (blob, queue or table) for the account, without a trailing slash.
+func (e Endpoint) ServiceURL(accountName string, service string) string {
+	if e.Emulator {
+		return fmt.Sprintf("http://%s/%s", emulatorHosts[service], storage.StorageEmulatorAccountName)
+	}
+
+	scheme := "https"
+	if !e.UseHTTPS {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s.%s.%s", scheme, accountName, service, e.BaseURL)
+}
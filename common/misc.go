@@ -1,5 +1,11 @@
 package common
 
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
 // misc consts for credentials.
 // need a more dynamic way to add for new cloud types.
 // but for now, it will do.
@@ -25,6 +31,20 @@ const (
 	S3DestAccessSecret = "S3DestAccessSecret"
 	S3DestRegion       = "S3DestRegion"
 
+	// S3 compatible storage (eg MinIO)
+	S3Endpoint = "S3Endpoint"
+
+	// Azure cloud or base URL the account lives in (see ParseEndpoint).
+	StorageEndpoint = "StorageEndpoint"
+
+	// profile from the config file.
+	ProfileName = "ProfileName"
+
+	// alternatives to account name/key.
+	ConnectionString = "ConnectionString"
+	SASToken         = "SASToken"
+	SASURL           = "SASURL"
+
 	// debug
 	Debug             = "Debug"
 	Source            = "Source"
@@ -37,8 +57,30 @@ const (
 	VisibilityTimeout = "VisibilityTimeout"
 	TTL               = "TTL"
 	SASPermissions    = "SASPermissions"
+	SASIPRange        = "SASIPRange"
+	SASIdentifier     = "SASIdentifier"
+	SASHTTPSOnly      = "SASHTTPSOnly" // generated SAS URLs only usable over https, "true" or "false"
 	Queue             = "Queue"
 	QueueMessage      = "QueueMessage"
+	DeleteSnapshots   = "DeleteSnapshots"
+	JournalDir        = "JournalDir"
+	BlockSize         = "BlockSize"
+	BlockConcurrency  = "BlockConcurrency"
+	MemoryBudget      = "MemoryBudget"
+	SyncDirection     = "SyncDirection"
+	DestContainer     = "DestContainer"
+	Output            = "Output"
+	Delimiter         = "Delimiter"
+	MaxResults        = "MaxResults"
+	Include           = "Include"
+	Exclude           = "Exclude"
+	NewerThan         = "NewerThan"
+	LargerThan        = "LargerThan"
+
+	// HTTP properties of uploaded blobs.
+	ContentType        = "ContentType"
+	CacheControl       = "CacheControl"
+	ContentDisposition = "ContentDisposition"
 
 	// container name to create.
 	CreateContainerName = "CreateContainer"
@@ -57,6 +99,10 @@ const (
 	CommandDownload
 	CommandSASURLBlob
 	CommandSASURLContainer
+	CommandDelete
+	CommandSync
+	CommandCopy
+	CommandVerify
 
 	CommandPushQueue
 	CommandPopQueue
@@ -67,8 +113,30 @@ const (
 	CommandClearQueue
 )
 
+// Snapshot handling when deleting blobs.
+const (
+	DeleteSnapshotsNone    = ""
+	DeleteSnapshotsInclude = "include"
+	DeleteSnapshotsOnly    = "only"
+)
+
+// Sync directions.
+const (
+	SyncUp   = "up"
+	SyncDown = "down"
+)
+
+// Overwrite policies, what upload and download do when the destination already exists.
+const (
+	OverwriteAlways      = "always"
+	OverwriteNever       = "never"
+	OverwriteIfNewer     = "ifnewer"     // only if the source was modified after the destination
+	OverwriteIfDifferent = "ifdifferent" // only if the size or MD5 (or without MD5, last modified) differs
+)
+
 // CloudConfig UGLY UGLY UGLY way to store the configuration.
-// globally accessible, otherwise I'm passing it everywhere.
+// Only used to gather the raw values from flags, env vars and the profile. Each tool then
+// validates it into typed options for the command being run.
 type CloudConfig struct {
 	Configuration map[string]string
 
@@ -76,13 +144,25 @@ type CloudConfig struct {
 
 	Command int // command we're executing
 
-	Replace bool // will replace at destination
-
 	Version bool // display version
 
 	ConcurrentCount uint // how many goroutines do we have in the pool?
 
-	ValidConfig bool // indicates if configuration is valid.
+	Resume bool // resume previously interrupted uploads
+
+	Mirror bool // sync deletes anything at the destination that isn't at the source
+
+	CheckMD5 bool // sync compares MD5 instead of last modified
+
+	Emulator bool // use the local storage emulator (Azurite) instead of Azure
+
+	Tree bool // list blobs as a tree of virtual directories
+
+	DiskUsage bool // list size and count of each virtual directory
+
+	DryRun bool // only print what would be changed
+
+	ContentRules []ContentRule // properties of uploaded blobs by pattern, from the profile
 }
 
 // NewCloudConfig  Make new (and only really) configuration map
@@ -91,3 +171,13 @@ func NewCloudConfig() *CloudConfig {
 	cc.Configuration = make(map[string]string)
 	return &cc
 }
+
+// ASTDir is the directory (~/.ast) where the tools keep local state.
+func ASTDir() string {
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("USERPROFILE")
+	}
+
+	return filepath.Join(home, ".ast")
+}
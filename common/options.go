@@ -0,0 +1,108 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Problems collects everything wrong with the configuration so it can all be reported at once,
+// before any calls to Azure are made.
+type Problems struct {
+	problems []string
+}
+
+// Add records a problem.
+func (p *Problems) Add(format string, args ...interface{}) {
+	p.problems = append(p.problems, fmt.Sprintf(format, args...))
+}
+
+// AddErr records err (if not nil) as a problem.
+func (p *Problems) AddErr(err error) {
+	if err != nil {
+		p.Add("%s", err)
+	}
+}
+
+// Required records a problem if value is empty. name is how the user gives it, eg -container
+func (p *Problems) Required(value string, name string, command string) string {
+	if value == "" {
+		p.Add("%s requires %s", command, name)
+	}
+	return value
+}
+
+// Int parses value, recording a problem if it isn't a number of at least min.
+func (p *Problems) Int(value string, name string, min int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		p.Add("Invalid %s %s, should be a number", name, value)
+		return 0
+	}
+
+	if i < min {
+		p.Add("Invalid %s %d, should be at least %d", name, i, min)
+	}
+	return i
+}
+
+// Size parses value (eg 4M), recording a problem if invalid. Empty is 0.
+func (p *Problems) Size(value string, name string) int64 {
+	if value == "" {
+		return 0
+	}
+
+	size, err := ParseSize(value)
+	if err != nil {
+		p.Add("Invalid %s: %s", name, err)
+	}
+	return size
+}
+
+// OneOf records a problem if value isn't one of allowed.
+func (p *Problems) OneOf(value string, name string, allowed ...string) string {
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+
+	p.Add("Invalid %s %s, should be one of %s", name, value, strings.Join(allowed, ", "))
+	return value
+}
+
+// Count is the number of problems so far.
+func (p *Problems) Count() int {
+	return len(p.problems)
+}
+
+// Err returns nil if there were no problems, otherwise an error listing all of them.
+func (p *Problems) Err() error {
+	if len(p.problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("Invalid configuration:\n  %s", strings.Join(p.problems, "\n  "))
+}
+
+// SASPolicyFromConfig creates the policy from the SAS options given on the command line, recording any problems.
+func SASPolicyFromConfig(config *CloudConfig, resource SASResourceType, problems *Problems) SASPolicy {
+	durationInSeconds := 0
+	if config.Configuration[SASTimeout] != "" {
+		count := problems.Count()
+		durationInSeconds = problems.Int(config.Configuration[SASTimeout], "-sastimeout", 1)
+
+		// already reported, don't also complain about the missing expiry.
+		if problems.Count() > count {
+			durationInSeconds = 1
+		}
+	}
+
+	policy, err := NewSASPolicy(resource, durationInSeconds, config.Configuration[SASPermissions], config.Configuration[SASIPRange], config.Configuration[SASHTTPSOnly] == "true", config.Configuration[SASIdentifier])
+	if err != nil {
+		problems.AddErr(err)
+		return SASPolicy{}
+	}
+
+	return *policy
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats for the listing commands.
+const (
+	OutputText  = "text" // just the names, one per line
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+	OutputTable = "table"
+)
+
+// OutputFormats are the valid -output values.
+var OutputFormats = []string{OutputText, OutputJSON, OutputCSV, OutputTable}
+
+// Row is a single result of a listing command. It is marshalled as is for json,
+// Values are used for csv and table (in the same order as the columns) and the first value for text (unless it's a Texter).
+type Row interface {
+	Values() []string
+}
+
+// Texter is implemented by rows that have more than just a name for the text format, eg size and count.
+type Texter interface {
+	Text() string
+}
+
+// OutputWriter writes rows as they are listed in the chosen format. Close must be called once done.
+type OutputWriter struct {
+	format  string
+	columns []string
+	w       io.Writer
+	csv     *csv.Writer
+	table   *tabwriter.Writer
+	count   int
+}
+
+// NewOutputWriter creates the writer for format (one of OutputFormats). columns is the header for csv and table.
+func NewOutputWriter(w io.Writer, format string, columns []string) *OutputWriter {
+	o := &OutputWriter{format: format, columns: columns, w: w}
+
+	switch format {
+	case OutputCSV:
+		o.csv = csv.NewWriter(w)
+		o.csv.Write(columns)
+	case OutputTable:
+		o.table = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(o.table, strings.Join(columns, "\t"))
+	}
+
+	return o
+}
+
+// Write outputs a single row.
+func (o *OutputWriter) Write(row Row) error {
+	defer func() { o.count++ }()
+
+	switch o.format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(row, "  ", "  ")
+		if err != nil {
+			return err
+		}
+
+		sep := ",\n"
+		if o.count == 0 {
+			sep = "[\n"
+		}
+		_, err = fmt.Fprintf(o.w, "%s  %s", sep, data)
+		return err
+
+	case OutputCSV:
+		return o.csv.Write(row.Values())
+
+	case OutputTable:
+		_, err := fmt.Fprintln(o.table, strings.Join(row.Values(), "\t"))
+		return err
+	}
+
+	if t, ok := row.(Texter); ok {
+		_, err := fmt.Fprintln(o.w, t.Text())
+		return err
+	}
+
+	_, err := fmt.Fprintln(o.w, row.Values()[0])
+	return err
+}
+
+// Close finishes the output, eg closing the json array.
+func (o *OutputWriter) Close() error {
+	switch o.format {
+	case OutputJSON:
+		if o.count == 0 {
+			_, err := fmt.Fprintln(o.w, "[]")
+			return err
+		}
+		_, err := fmt.Fprintln(o.w, "\n]")
+		return err
+
+	case OutputCSV:
+		o.csv.Flush()
+		return o.csv.Error()
+
+	case OutputTable:
+		return o.table.Flush()
+	}
+
+	return nil
+}
+
+// FormatMetadata converts metadata into a single k=v;k2=v2 value (sorted by key) for csv and table output.
+func FormatMetadata(metadata map[string]string) string {
+	keys := []string{}
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+metadata[k])
+	}
+	return strings.Join(pairs, ";")
+}
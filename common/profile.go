@@ -0,0 +1,172 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Profile is a named set of defaults from the config file (~/.ast/config.yaml).
+// Anything given as a flag or env var trumps the profile.
+type Profile struct {
+	AccountName      string `yaml:"accountname"`
+	AccountKey       string `yaml:"accountkey"`
+	ConnectionString string `yaml:"connectionstring"`
+	SASToken         string `yaml:"sastoken"`
+	Endpoint         string `yaml:"endpoint"`
+	Emulator         bool   `yaml:"emulator"`
+
+	Container       string `yaml:"container"`
+	Queue           string `yaml:"queue"`
+	ConcurrentCount uint   `yaml:"concurrency"`
+
+	SASTimeout     string `yaml:"sastimeout"`
+	SASPermissions string `yaml:"sasperms"`
+	SASHTTPSOnly   bool   `yaml:"sashttps"`
+
+	ContentRules []ContentRule `yaml:"contentrules"`
+}
+
+// ContentRule sets the HTTP properties of uploaded blobs whose names match the pattern (a glob or regex:, same as -include).
+// Only the properties given are set.
+type ContentRule struct {
+	Pattern            string `yaml:"pattern"`
+	ContentType        string `yaml:"contenttype"`
+	ContentEncoding    string `yaml:"contentencoding"`
+	CacheControl       string `yaml:"cachecontrol"`
+	ContentDisposition string `yaml:"contentdisposition"`
+}
+
+// ConfigFile is the layout of the config file, eg
+//
+//	default: dev
+//	profiles:
+//	  dev:
+//	    emulator: true
+//	    container: temp
+//	  prod:
+//	    connectionstring: DefaultEndpointsProtocol=https;AccountName=...
+//	    concurrency: 20
+//	    contentrules:
+//	      - pattern: "*.html"
+//	        cachecontrol: no-cache
+type ConfigFile struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// ConfigFilePath is AST_CONFIG if set, otherwise ~/.ast/config.yaml
+func ConfigFilePath() string {
+	if os.Getenv("AST_CONFIG") != "" {
+		return os.Getenv("AST_CONFIG")
+	}
+
+	return filepath.Join(ASTDir(), "config.yaml")
+}
+
+// LoadConfigFile reads the config file. A missing file is just an empty config.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	cf := ConfigFile{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cf, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return nil, fmt.Errorf("Unable to read config file %s: %s", path, err)
+	}
+
+	return &cf, nil
+}
+
+// LoadProfile returns the profile to use. name is the -profile flag, then AST_PROFILE, then the
+// config file's default. With no profile selected (or no config file) an empty profile is returned.
+func LoadProfile(name string) (Profile, error) {
+	path := ConfigFilePath()
+	cf, err := LoadConfigFile(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	name = FirstSet(name, os.Getenv("AST_PROFILE"), cf.Default)
+	if name == "" {
+		return Profile{}, nil
+	}
+
+	profile, ok := cf.Profiles[name]
+	if !ok {
+		names := []string{}
+		for n := range cf.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("Profile %s not found in %s. Available profiles: %s", name, path, strings.Join(names, ", "))
+	}
+
+	return profile, nil
+}
+
+// FirstSet returns the first non-empty value. Used for flag > env var > profile > default precedence.
+func FirstSet(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// defaults when not given by flag, env var or profile.
+const (
+	DefaultConcurrentCount = 5
+	DefaultSASTimeout      = "60"
+	DefaultSASPermissions  = "r"
+)
+
+// ApplyProfile fills in anything that wasn't given as a flag or env var from the profile, then the defaults.
+// Credentials are all or nothing, the profile's are only used if no account, connection string or emulator was given.
+func ApplyProfile(config *CloudConfig, profile Profile) {
+	if config.Configuration[AzureDefaultAccountName] == "" && config.Configuration[ConnectionString] == "" && !config.Emulator {
+		config.Configuration[AzureDefaultAccountName] = profile.AccountName
+		config.Configuration[AzureDefaultAccountKey] = profile.AccountKey
+		config.Configuration[ConnectionString] = profile.ConnectionString
+		config.Configuration[SASToken] = FirstSet(config.Configuration[SASToken], profile.SASToken)
+		config.Emulator = profile.Emulator
+	}
+
+	// STORAGE_ENDPOINT is read later, when the endpoint is parsed.
+	if config.Configuration[StorageEndpoint] == "" && os.Getenv("STORAGE_ENDPOINT") == "" {
+		config.Configuration[StorageEndpoint] = profile.Endpoint
+	}
+
+	config.Configuration[Container] = FirstSet(config.Configuration[Container], profile.Container)
+	config.Configuration[Queue] = FirstSet(config.Configuration[Queue], profile.Queue)
+	config.Configuration[SASTimeout] = FirstSet(config.Configuration[SASTimeout], profile.SASTimeout)
+	config.Configuration[SASPermissions] = FirstSet(config.Configuration[SASPermissions], profile.SASPermissions)
+
+	// with a stored access policy the timeout and permissions come from it, unless given.
+	if config.Configuration[SASIdentifier] == "" {
+		config.Configuration[SASTimeout] = FirstSet(config.Configuration[SASTimeout], DefaultSASTimeout)
+		config.Configuration[SASPermissions] = FirstSet(config.Configuration[SASPermissions], DefaultSASPermissions)
+	}
+	config.Configuration[SASHTTPSOnly] = FirstSet(config.Configuration[SASHTTPSOnly], strconv.FormatBool(profile.SASHTTPSOnly))
+	config.ContentRules = profile.ContentRules
+
+	if config.ConcurrentCount == 0 {
+		config.ConcurrentCount = profile.ConcurrentCount
+	}
+	if config.ConcurrentCount == 0 {
+		config.ConcurrentCount = DefaultConcurrentCount
+	}
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyProfileSASDefaults(t *testing.T) {
+	config := NewCloudConfig()
+	ApplyProfile(config, Profile{})
+
+	if config.Configuration[SASTimeout] != DefaultSASTimeout || config.Configuration[SASPermissions] != DefaultSASPermissions {
+		t.Errorf("got timeout %s permissions %s, expected the defaults", config.Configuration[SASTimeout], config.Configuration[SASPermissions])
+	}
+
+	// with a stored access policy the defaults would repeat what the policy defines.
+	config = NewCloudConfig()
+	config.Configuration[SASIdentifier] = "policy1"
+	ApplyProfile(config, Profile{})
+
+	if config.Configuration[SASTimeout] != "" || config.Configuration[SASPermissions] != "" {
+		t.Errorf("got timeout %s permissions %s with -sasid, expected none", config.Configuration[SASTimeout], config.Configuration[SASPermissions])
+	}
+
+	// but the profile's are still used.
+	config = NewCloudConfig()
+	config.Configuration[SASIdentifier] = "policy1"
+	ApplyProfile(config, Profile{SASPermissions: "rl"})
+
+	if config.Configuration[SASPermissions] != "rl" {
+		t.Errorf("got permissions %s, expected the profile's rl", config.Configuration[SASPermissions])
+	}
+}
+
+func TestParseSASHTTPSOverridesProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("profiles:\n  https:\n    sashttps: true\n  plain: {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	old := os.Getenv("AST_CONFIG")
+	os.Setenv("AST_CONFIG", path)
+	defer os.Setenv("AST_CONFIG", old)
+
+	tool := Tool{Name: "test"}
+	sub := Subcommand{Name: "sas", Flags: func(f *Flags) {
+		f.String(ProfileName, "profile", "", "")
+		f.SASFlags("r")
+	}}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-profile", "https"}, "true"},
+		{[]string{"-profile", "https", "-sashttps=false"}, "false"},
+		{[]string{"-profile", "plain"}, "false"},
+		{[]string{"-profile", "plain", "-sashttps"}, "true"},
+	}
+
+	for _, test := range tests {
+		config, err := tool.Parse("test", sub, test.args)
+		if err != nil {
+			t.Fatalf("%v: %s", test.args, err)
+		}
+
+		if got := config.Configuration[SASHTTPSOnly]; got != test.expected {
+			t.Errorf("%v: got sashttps %s, expected %s", test.args, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// storage service version used to sign SAS tokens.
+	SASVersion = "2016-05-31"
+
+	// format of st and se values
+	sasTimeFormat = "2006-01-02T15:04:05Z"
+
+	// start the SAS slightly in the past to allow for clock skew between us and Azure.
+	sasClockSkew = 5 * time.Minute
+)
+
+// SASResourceType is what the SAS is being generated for.
+type SASResourceType int
+
+// Resources we can generate SAS for.
+const (
+	SASResourceBlob SASResourceType = iota
+	SASResourceContainer
+	SASResourceQueue
+)
+
+// sasPermissions are the permissions allowed per resource type, in the order Azure expects them.
+var sasPermissions = map[SASResourceType]string{
+	SASResourceBlob:      "racwd",
+	SASResourceContainer: "racwdl",
+	SASResourceQueue:     "raup",
+}
+
+// SASPolicy describes the SAS that is going to be signed.
+// If Identifier (stored access policy) is set then Permissions, Start and Expiry
+// may be left empty and will be taken from the stored policy instead. Azure rejects a SAS that
+// repeats a field the stored policy defines, so only the fields that are set are signed.
+type SASPolicy struct {
+	Resource    SASResourceType
+	Start       time.Time
+	Expiry      time.Time
+	Permissions string
+	IPRange     string // single IP or range, eg 168.1.5.60-168.1.5.70
+	HTTPSOnly   bool
+	Identifier  string // stored access policy identifier
+}
+
+// NewSASPolicy creates a policy starting now (allowing for clock skew) and expiring durationInSeconds from now.
+// Permissions are validated for the resource type.
+// With a stored access policy identifier and no duration, there is no start or expiry (the stored policy has them).
+func NewSASPolicy(resource SASResourceType, durationInSeconds int, permissions string, ipRange string, httpsOnly bool, identifier string) (*SASPolicy, error) {
+	policy := SASPolicy{
+		Resource:    resource,
+		Permissions: permissions,
+		IPRange:     ipRange,
+		HTTPSOnly:   httpsOnly,
+		Identifier:  identifier,
+	}
+
+	now := time.Now().UTC()
+	if durationInSeconds > 0 {
+		policy.Start = now.Add(-sasClockSkew)
+		policy.Expiry = now.Add(time.Second * time.Duration(durationInSeconds))
+	} else if identifier == "" {
+		policy.Start = now.Add(-sasClockSkew)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Validate checks the policy makes sense for its resource type.
+// Permissions are put into the order Azure requires.
+func (p *SASPolicy) Validate() error {
+	allowed, ok := sasPermissions[p.Resource]
+	if !ok {
+		return fmt.Errorf("Unknown SAS resource type %d", p.Resource)
+	}
+
+	if p.Identifier == "" {
+		if p.Permissions == "" {
+			return fmt.Errorf("No SAS permissions given, allowed are %s", allowed)
+		}
+
+		if p.Expiry.IsZero() {
+			return fmt.Errorf("SAS requires an expiry (timeout) when no stored access policy is used")
+		}
+	}
+
+	if !p.Expiry.IsZero() && !p.Expiry.After(p.Start) {
+		return fmt.Errorf("SAS expiry %s is before start %s", p.Expiry, p.Start)
+	}
+
+	for _, perm := range p.Permissions {
+		if !strings.ContainsRune(allowed, perm) {
+			return fmt.Errorf("Invalid SAS permission %c, allowed are %s", perm, allowed)
+		}
+	}
+
+	perms := ""
+	for _, perm := range allowed {
+		if strings.ContainsRune(p.Permissions, perm) {
+			perms += string(perm)
+		}
+	}
+	p.Permissions = perms
+
+	return nil
+}
+
+// Protocol returns the signed protocol value.
+func (p SASPolicy) Protocol() string {
+	if p.HTTPSOnly {
+		return "https"
+	}
+	return "https,http"
+}
+
+// Sign generates the SAS query parameters (including signature) for the resource.
+// canonicalizedResource is the /blob/account/container/blob or /queue/account/queue form.
+func (p SASPolicy) Sign(accountKey string, canonicalizedResource string) (url.Values, error) {
+
+	signedStart := formatSASTime(p.Start)
+	signedExpiry := formatSASTime(p.Expiry)
+	protocol := p.Protocol()
+
+	fields := []string{
+		p.Permissions,
+		signedStart,
+		signedExpiry,
+		canonicalizedResource,
+		p.Identifier,
+		p.IPRange,
+		protocol,
+		SASVersion,
+	}
+
+	// blob and container SAS also sign the response header overrides (rscc, rscd, rsce, rscl, rsct)
+	// which we never set.
+	signedResource := ""
+	switch p.Resource {
+	case SASResourceBlob:
+		signedResource = "b"
+		fields = append(fields, "", "", "", "", "")
+	case SASResourceContainer:
+		signedResource = "c"
+		fields = append(fields, "", "", "", "", "")
+	}
+
+	sig, err := ComputeSignature(accountKey, strings.Join(fields, "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("sv", SASVersion)
+	if signedResource != "" {
+		params.Set("sr", signedResource)
+	}
+	setIfNotEmpty(params, "sp", p.Permissions)
+	setIfNotEmpty(params, "st", signedStart)
+	setIfNotEmpty(params, "se", signedExpiry)
+	setIfNotEmpty(params, "si", p.Identifier)
+	setIfNotEmpty(params, "sip", p.IPRange)
+	params.Set("spr", protocol)
+	params.Set("sig", sig)
+
+	return params, nil
+}
+
+// ComputeSignature HMAC-SHA256 the string with the (base64 encoded) account key.
+func ComputeSignature(accountKey string, stringToSign string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(accountKey)
+	if err != nil {
+		return "", fmt.Errorf("Invalid account key: %s", err)
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+func formatSASTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(sasTimeFormat)
+}
+
+func setIfNotEmpty(params url.Values, key string, value string) {
+	if value != "" {
+		params.Set(key, value)
+	}
+}
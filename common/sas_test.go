@@ -0,0 +1,123 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// base64 of the bytes 0..63, a fixed account key for the known signatures.
+const testAccountKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKissLS4vMDEyMzQ1Njc4OTo7PD0+Pw=="
+
+var (
+	testSASStart  = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	testSASExpiry = testSASStart.Add(time.Hour)
+)
+
+// The expected signatures were computed independently of Sign, from the string-to-sign in the
+// service SAS documentation for version 2016-05-31 (13 fields for blob/container, 8 for queue).
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   SASPolicy
+		resource string
+		query    string
+	}{
+		{
+			name:     "container",
+			policy:   SASPolicy{Resource: SASResourceContainer, Start: testSASStart, Expiry: testSASExpiry, Permissions: "rl"},
+			resource: "/blob/myaccount/mycontainer",
+			query:    "se=2026-01-02T04%3A04%3A05Z&sig=cIo1N1FNtu7a%2FpiuXZEwX7OvqABaxTWMjozS0OQzmMc%3D&sp=rl&spr=https%2Chttp&sr=c&st=2026-01-02T03%3A04%3A05Z&sv=2016-05-31",
+		},
+		{
+			name:     "blob",
+			policy:   SASPolicy{Resource: SASResourceBlob, Start: testSASStart, Expiry: testSASExpiry, Permissions: "r"},
+			resource: "/blob/myaccount/mycontainer/dir/my blob.txt",
+			query:    "se=2026-01-02T04%3A04%3A05Z&sig=eRxrs8JiNOzOtQGZz04JR6AjF7cEziOwa8Sry9bOo%2BQ%3D&sp=r&spr=https%2Chttp&sr=b&st=2026-01-02T03%3A04%3A05Z&sv=2016-05-31",
+		},
+		{
+			name:     "queue",
+			policy:   SASPolicy{Resource: SASResourceQueue, Start: testSASStart, Expiry: testSASExpiry, Permissions: "raup"},
+			resource: "/queue/myaccount/myqueue",
+			query:    "se=2026-01-02T04%3A04%3A05Z&sig=xtQnBlzzLeZQNF8%2FMNorqn89VKMuPp5iLM%2ByWuv%2BQ6k%3D&sp=raup&spr=https%2Chttp&st=2026-01-02T03%3A04%3A05Z&sv=2016-05-31",
+		},
+		{
+			name:     "blob ip range and https only",
+			policy:   SASPolicy{Resource: SASResourceBlob, Start: testSASStart, Expiry: testSASExpiry, Permissions: "rw", IPRange: "168.1.5.60-168.1.5.70", HTTPSOnly: true},
+			resource: "/blob/myaccount/mycontainer/a.txt",
+			query:    "se=2026-01-02T04%3A04%3A05Z&sig=T93z%2BVwi4T%2Fg5kdYXG8fWTXLKTnUuQc3iZnplcGJi%2BM%3D&sip=168.1.5.60-168.1.5.70&sp=rw&spr=https&sr=b&st=2026-01-02T03%3A04%3A05Z&sv=2016-05-31",
+		},
+		{
+			name:     "queue stored access policy",
+			policy:   SASPolicy{Resource: SASResourceQueue, Identifier: "policy1"},
+			resource: "/queue/myaccount/myqueue",
+			query:    "si=policy1&sig=nLRyr%2BbrCqQnhssTuvQpmvSzBzvkQPS13aB5NetC6QA%3D&spr=https%2Chttp&sv=2016-05-31",
+		},
+	}
+
+	for _, test := range tests {
+		params, err := test.policy.Sign(testAccountKey, test.resource)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if query := params.Encode(); query != test.query {
+			t.Errorf("%s: got %s, expected %s", test.name, query, test.query)
+		}
+	}
+}
+
+func TestSignInvalidKey(t *testing.T) {
+	policy := SASPolicy{Resource: SASResourceBlob, Start: testSASStart, Expiry: testSASExpiry, Permissions: "r"}
+	if _, err := policy.Sign("not base64!", "/blob/myaccount/mycontainer/a.txt"); err == nil {
+		t.Errorf("expected an error for an invalid key")
+	}
+}
+
+func TestValidateOrdersPermissions(t *testing.T) {
+	policy := SASPolicy{Resource: SASResourceContainer, Start: testSASStart, Expiry: testSASExpiry, Permissions: "ldr"}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Permissions != "rdl" {
+		t.Errorf("got permissions %s, expected rdl", policy.Permissions)
+	}
+
+	policy.Permissions = "x"
+	if err := policy.Validate(); err == nil {
+		t.Errorf("expected an error for permission x")
+	}
+}
+
+func TestNewSASPolicyStoredAccessPolicy(t *testing.T) {
+	policy, err := NewSASPolicy(SASResourceContainer, 0, "", "", false, "policy1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := policy.Sign(testAccountKey, "/blob/myaccount/mycontainer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"st", "se", "sp"} {
+		if params.Get(field) != "" {
+			t.Errorf("%s is set to %s, should come from the stored access policy", field, params.Get(field))
+		}
+	}
+
+	if params.Get("si") != "policy1" {
+		t.Errorf("got si %s, expected policy1", params.Get("si"))
+	}
+
+	// an explicit timeout is still used.
+	policy, err = NewSASPolicy(SASResourceContainer, 60, "", "", false, "policy1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if policy.Start.IsZero() || policy.Expiry.IsZero() {
+		t.Errorf("expected start and expiry with a timeout, got %s and %s", policy.Start, policy.Expiry)
+	}
+}
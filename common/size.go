@@ -0,0 +1,56 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSize parses sizes such as 512, 100K, 8MB or 2G into bytes.
+// Units are powers of 1024.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1024 * 1024 * 1024
+	case strings.HasSuffix(s, "T"):
+		multiplier = 1024 * 1024 * 1024 * 1024
+	}
+
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid size %s", size)
+	}
+
+	return value * multiplier, nil
+}
+
+// FormatSize formats bytes using the same units as ParseSize, eg 1.5M
+func FormatSize(size int64) string {
+	if size < 1024 {
+		return strconv.FormatInt(size, 10)
+	}
+
+	value := float64(size)
+	unit := ""
+	for _, u := range []string{"K", "M", "G", "T"} {
+		if value < 1024 {
+			break
+		}
+		value /= 1024
+		unit = u
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + unit
+}
@@ -0,0 +1,130 @@
+package Command
+
+import (
+	"azurestoragetools/common"
+	"azurestoragetools/queue/Handler"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Tool is astqueue, "ast queue".
+var Tool = common.Tool{
+	Name:    "queue",
+	Summary: "Azure Storage Tools Queue. Push, pop and peek messages, manage queues and generate SAS URLs.",
+	Subcommands: []common.Subcommand{
+		{Name: "push", Command: common.CommandPushQueue, Summary: "Push message to queue", Flags: pushFlags},
+		{Name: "pop", Command: common.CommandPopQueue, Summary: "Pop message from queue", Flags: queueFlags},
+		{Name: "peek", Command: common.CommandPeekQueue, Summary: "Peek message at front of queue", Flags: queueFlags},
+		{Name: "size", Command: common.CommandSizeQueue, Summary: "Get approximate size of queue", Flags: queueFlags},
+		{Name: "clear", Command: common.CommandClearQueue, Summary: "Clear queue", Flags: queueFlags},
+		{Name: "createqueue", Command: common.CommandCreateQueue, Summary: "Create queue for Azure", Flags: queueFlags},
+		{Name: "queuesas", Command: common.CommandGenerateQueueSAS, Summary: "Generate Queue SAS URL", Flags: queueSASFlags},
+	},
+	Run: run,
+}
+
+// commandPermissions are the SAS permissions each command needs, checked up front when only a SAS token is given.
+var commandPermissions = map[int]string{
+	common.CommandPushQueue:   "a",
+	common.CommandPopQueue:    "p",
+	common.CommandPeekQueue:   "r",
+	common.CommandSizeQueue:   "r",
+	common.CommandClearQueue:  "d",
+	common.CommandCreateQueue: "c",
+}
+
+// commandNames are used in permission errors.
+var commandNames = map[int]string{
+	common.CommandPushQueue:        "push",
+	common.CommandPopQueue:         "pop",
+	common.CommandPeekQueue:        "peek",
+	common.CommandSizeQueue:        "size",
+	common.CommandClearQueue:       "clear",
+	common.CommandCreateQueue:      "createqueue",
+	common.CommandGenerateQueueSAS: "queuesas",
+}
+
+func queueFlags(f *common.Flags) {
+	f.AccountFlags()
+	f.String(common.Queue, "queue", "", "Queue used for command")
+}
+
+func pushFlags(f *common.Flags) {
+	queueFlags(f)
+	f.String(common.QueueMessage, "message", "", "Message to push")
+	f.StringDefault(common.VisibilityTimeout, "vtimeout", "0", "Optional: visibility time for queue messsage")
+	f.StringDefault(common.TTL, "ttl", "0", "Optional: Time to live for queue messsage.")
+}
+
+func queueSASFlags(f *common.Flags) {
+	queueFlags(f)
+	f.SASFlags("raup (read, add, update, process)")
+}
+
+// run validates the configuration then runs the command.
+func run(config *common.CloudConfig) error {
+
+	// everything is checked before talking to Azure.
+	opts, err := validateOptions(config)
+	if err != nil {
+		return err
+	}
+	log.Debugf("options %s", opts)
+
+	qh, err := Handler.NewQueueHandler(opts.Account)
+	if err != nil {
+		return err
+	}
+	qh.SetDryRun(opts.DryRun)
+
+	switch opts.Command {
+
+	case common.CommandSizeQueue:
+		sz, err := qh.QueueSize(opts.Queue)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%d", sz)
+
+	case common.CommandCreateQueue:
+		return qh.CreateQueue(opts.Queue)
+
+	case common.CommandPushQueue:
+		if opts.TTL > 0 || opts.VisibilityTimeout > 0 {
+			return qh.PushQueueWithTimeouts(opts.Queue, opts.Message, opts.TTL, opts.VisibilityTimeout)
+		}
+		return qh.PushQueue(opts.Queue, opts.Message)
+
+	case common.CommandPopQueue:
+		msg, err := qh.PopQueue(opts.Queue)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s", msg)
+
+	case common.CommandClearQueue:
+		return qh.ClearQueue(opts.Queue)
+
+	case common.CommandPeekQueue:
+		msg, err := qh.PeekQueue(opts.Queue)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s", msg)
+
+	case common.CommandGenerateQueueSAS:
+		msg, err := qh.GenerateSASURL(opts.Queue, opts.SASPolicy)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s", msg)
+
+	default:
+		return fmt.Errorf("Unsure of command to execute")
+	}
+
+	return nil
+}
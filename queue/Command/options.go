@@ -0,0 +1,61 @@
+package Command
+
+import (
+	"azurestoragetools/common"
+	"fmt"
+)
+
+// queueOptions is the validated configuration for the command being run.
+type queueOptions struct {
+	Command int
+	Account common.Account
+	Queue   string
+	DryRun  bool
+
+	// push
+	Message           string
+	TTL               int
+	VisibilityTimeout int
+
+	// queuesas
+	SASPolicy common.SASPolicy
+}
+
+// validateOptions checks the configuration for the command and converts it into queueOptions.
+// Every problem found is reported in the returned error.
+func validateOptions(config *common.CloudConfig) (*queueOptions, error) {
+	problems := common.Problems{}
+	opts := queueOptions{Command: config.Command, DryRun: config.DryRun}
+	c := config.Configuration
+	name := commandNames[config.Command]
+
+	account, err := common.AccountFromConfig(config)
+	problems.AddErr(err)
+	if err == nil {
+		problems.AddErr(account.CheckSASPermissions(commandPermissions[config.Command], name))
+	}
+	opts.Account = account
+
+	opts.Queue = problems.Required(c[common.Queue], "-queue", name)
+
+	switch config.Command {
+	case common.CommandPushQueue:
+		opts.Message = problems.Required(c[common.QueueMessage], "-message", name)
+		opts.TTL = problems.Int(c[common.TTL], "-ttl", 0)
+		opts.VisibilityTimeout = problems.Int(c[common.VisibilityTimeout], "-vtimeout", 0)
+
+	case common.CommandGenerateQueueSAS:
+		opts.SASPolicy = common.SASPolicyFromConfig(config, common.SASResourceQueue, &problems)
+	}
+
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+
+	return &opts, nil
+}
+
+// String is used for debug logging, without any credentials.
+func (o queueOptions) String() string {
+	return fmt.Sprintf("command %s account %s queue %s", commandNames[o.Command], o.Account.Name, o.Queue)
+}
@@ -0,0 +1,197 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// MemoryQueueService is an in-memory QueueService so QueueHandler can be run (and tested) without an Azure account.
+// Messages are kept in order. Got messages are invisible until deleted, visibility timeouts and TTLs are ignored.
+type MemoryQueueService struct {
+	lock      sync.Mutex
+	queues    map[string]*memoryQueueData
+	messageID int
+}
+
+type memoryQueueData struct {
+	messages  []storage.Message
+	invisible map[string]storage.Message
+}
+
+// NewMemoryQueueService creates an empty MemoryQueueService.
+func NewMemoryQueueService() *MemoryQueueService {
+	return &MemoryQueueService{queues: make(map[string]*memoryQueueData)}
+}
+
+// memoryError creates the same error type the SDK returns for failed requests.
+func memoryError(statusCode int, code string) error {
+	return storage.AzureStorageServiceError{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    fmt.Sprintf("%d %s", statusCode, code),
+	}
+}
+
+// GetQueueReference returns a reference to the queue, which may not exist yet.
+func (s *MemoryQueueService) GetQueueReference(name string) Queue {
+	return &memoryQueue{service: s, name: name}
+}
+
+// getQueueData returns the queue. Caller holds the lock.
+func (s *MemoryQueueService) getQueueData(name string) (*memoryQueueData, error) {
+	data, ok := s.queues[name]
+	if !ok {
+		return nil, memoryError(http.StatusNotFound, "QueueNotFound")
+	}
+	return data, nil
+}
+
+type memoryQueue struct {
+	service           *MemoryQueueService
+	name              string
+	aproxMessageCount uint64
+}
+
+func (q *memoryQueue) Exists() (bool, error) {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	_, ok := q.service.queues[q.name]
+	return ok, nil
+}
+
+func (q *memoryQueue) Create(options *storage.QueueServiceOptions) error {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	if _, ok := q.service.queues[q.name]; !ok {
+		q.service.queues[q.name] = &memoryQueueData{invisible: make(map[string]storage.Message)}
+	}
+	return nil
+}
+
+func (q *memoryQueue) ClearMessages(options *storage.QueueServiceOptions) error {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return err
+	}
+
+	data.messages = nil
+	data.invisible = make(map[string]storage.Message)
+	return nil
+}
+
+func (q *memoryQueue) GetMetadata(options *storage.QueueServiceOptions) error {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return err
+	}
+
+	q.aproxMessageCount = uint64(len(data.messages) + len(data.invisible))
+	return nil
+}
+
+func (q *memoryQueue) ApproximateMessageCount() uint64 {
+	return q.aproxMessageCount
+}
+
+func (q *memoryQueue) PutMessage(text string, options *storage.PutMessageOptions) error {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return err
+	}
+
+	q.service.messageID++
+	data.messages = append(data.messages, storage.Message{
+		ID:   fmt.Sprintf("%d", q.service.messageID),
+		Text: text,
+	})
+	return nil
+}
+
+func (q *memoryQueue) GetMessages(options *storage.GetMessagesOptions) ([]storage.Message, error) {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := 0
+	if options != nil {
+		requested = options.NumOfMessages
+	}
+
+	count := numOfMessages(requested, len(data.messages))
+	messages := data.messages[:count]
+	data.messages = data.messages[count:]
+
+	for i := range messages {
+		messages[i].DequeueCount++
+		messages[i].PopReceipt = fmt.Sprintf("pop-%s", messages[i].ID)
+		data.invisible[messages[i].ID] = messages[i]
+	}
+
+	return messages, nil
+}
+
+func (q *memoryQueue) PeekMessages(options *storage.PeekMessagesOptions) ([]storage.Message, error) {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := 0
+	if options != nil {
+		requested = options.NumOfMessages
+	}
+
+	count := numOfMessages(requested, len(data.messages))
+	messages := make([]storage.Message, count)
+	copy(messages, data.messages[:count])
+	return messages, nil
+}
+
+func (q *memoryQueue) DeleteMessage(message storage.Message, options *storage.QueueServiceOptions) error {
+	q.service.lock.Lock()
+	defer q.service.lock.Unlock()
+
+	data, err := q.service.getQueueData(q.name)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := data.invisible[message.ID]; !ok {
+		return memoryError(http.StatusNotFound, "MessageNotFound")
+	}
+
+	delete(data.invisible, message.ID)
+	return nil
+}
+
+// numOfMessages is how many messages a get/peek returns. Azure defaults to 1.
+func numOfMessages(requested int, available int) int {
+	if requested <= 0 {
+		requested = 1
+	}
+
+	if requested > available {
+		return available
+	}
+	return requested
+}
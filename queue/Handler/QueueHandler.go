@@ -2,10 +2,9 @@ package Handler
 
 import (
 	"azure-sdk-for-go/storage"
+	"azurestoragetools/common"
 	"errors"
-	"sync"
-
-	"time"
+	"fmt"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -15,30 +14,53 @@ type QueueHandler struct {
 	// creds.
 	accountName        string
 	accountKey         string
-	queueStorageClient storage.QueueServiceClient
-}
+	queueStorageClient QueueService
 
-var wg sync.WaitGroup
+	// where the account lives, used to build queue URLs.
+	endpoint common.Endpoint
 
-// NewQueueHandler   create new instance of QueueHandler
-func NewQueueHandler(accountName string, accountKey string) (*QueueHandler, error) {
-	qh := new(QueueHandler)
+	// only print what would be changed.
+	dryRun bool
+}
 
-	client, err := storage.NewBasicClient(accountName, accountKey)
+// NewQueueHandler   create new instance of QueueHandler
+// account can use either the account key or a SAS token.
+func NewQueueHandler(account common.Account) (*QueueHandler, error) {
+	client, err := account.NewStorageClient()
 
 	if err != nil {
 		return nil, err
 	}
 
+	qh := NewQueueHandlerWithService(account.Name, account.Key, azureQueueService{client: client.GetQueueService()})
+	qh.endpoint = account.Endpoint
+	return qh, nil
+}
+
+// NewQueueHandlerWithService create new instance of QueueHandler using the given QueueService.
+// eg MemoryQueueService to run without an Azure account.
+func NewQueueHandlerWithService(accountName string, accountKey string, service QueueService) *QueueHandler {
+	qh := new(QueueHandler)
+
 	qh.accountName = accountName
 	qh.accountKey = accountKey
-	qh.queueStorageClient = client.GetQueueService()
-	return qh, nil
+	qh.queueStorageClient = service
+	qh.endpoint = common.DefaultEndpoint()
+	return qh
 }
 
-// GenerateSASURL generates SAS URL for blob
-func (qh QueueHandler) GenerateSASURL(queueName string, durationInSeconds int, permissions string) (string, error) {
+// SetDryRun makes create, push, pop and clear only print what they would do. Nothing is written.
+func (qh *QueueHandler) SetDryRun(dryRun bool) {
+	qh.dryRun = dryRun
+}
+
+// GenerateSASURL generates SAS URL for queue
+func (qh QueueHandler) GenerateSASURL(queueName string, policy common.SASPolicy) (string, error) {
 	log.Debugf("GenerateSASURL %s", queueName)
+	if qh.accountKey == "" {
+		return "", errors.New("Generating a SAS URL requires the account key, only a SAS token was given")
+	}
+
 	queue := qh.queueStorageClient.GetQueueReference(queueName)
 	doesExist, err := queue.Exists()
 	if err != nil {
@@ -49,15 +71,22 @@ func (qh QueueHandler) GenerateSASURL(queueName string, durationInSeconds int, p
 		return "", errors.New("Queue does not exist")
 	}
 
-	expiry := time.Now().UTC().Add(time.Hour)
+	log.Debugf("start %s", policy.Start)
+	log.Debugf("expiry %s", policy.Expiry)
 
-	sas, err := queue.GetSASURI(expiry, "p")
+	resource := fmt.Sprintf("/queue/%s/%s", qh.accountName, queueName)
+	params, err := policy.Sign(qh.accountKey, resource)
 	if err != nil {
-		log.Debug("error %s", err)
+		log.Debugf("error %s", err)
 		return "", err
 	}
 
-	return sas, nil
+	return fmt.Sprintf("%s?%s", qh.queueURL(queueName), params.Encode()), nil
+}
+
+// queueURL is the URL of the queue, the SDK doesn't expose it.
+func (qh QueueHandler) queueURL(queueName string) string {
+	return fmt.Sprintf("%s/%s", qh.endpoint.ServiceURL(qh.accountName, "queue"), queueName)
 }
 
 // CreateQueue creates a new queue
@@ -65,6 +94,20 @@ func (qh QueueHandler) CreateQueue(queueName string) error {
 
 	log.Debugf("CreateQueue %s", queueName)
 	queue := qh.queueStorageClient.GetQueueReference(queueName)
+	if qh.dryRun {
+		doesExist, err := queue.Exists()
+		if err != nil {
+			return err
+		}
+
+		if doesExist {
+			fmt.Printf("Dry run, queue %s already exists\n", queueName)
+			return nil
+		}
+		fmt.Printf("Dry run, would create queue %s\n", queueName)
+		return nil
+	}
+
 	err := queue.Create(nil)
 	if err != nil {
 		return err
@@ -86,8 +129,12 @@ func (qh QueueHandler) pushQueue(queueName string, message string, options *stor
 		return errors.New("Queue does not exist")
 	}
 
-	msg := queue.GetMessageReference(message)
-	err = msg.Put(options)
+	if qh.dryRun {
+		fmt.Printf("Dry run, would push message (%d bytes) to queue %s\n", len(message), queueName)
+		return nil
+	}
+
+	err = queue.PutMessage(message, options)
 	if err != nil {
 		return err
 	}
@@ -126,6 +173,15 @@ func (qh QueueHandler) ClearQueue(queueName string) error {
 		return errors.New("Queue does not exist")
 	}
 
+	if qh.dryRun {
+		if err := queue.GetMetadata(nil); err != nil {
+			return err
+		}
+
+		fmt.Printf("Dry run, would delete about %d messages from queue %s\n", queue.ApproximateMessageCount(), queueName)
+		return nil
+	}
+
 	err = queue.ClearMessages(nil)
 	if err != nil {
 		return err
@@ -146,6 +202,12 @@ func (qh QueueHandler) PopQueue(queueName string) (string, error) {
 		return "", errors.New("Queue does not exist")
 	}
 
+	// the message that would be popped is the one at the front.
+	if qh.dryRun {
+		fmt.Printf("Dry run, would pop message from queue %s:\n", queueName)
+		return qh.PeekQueue(queueName)
+	}
+
 	msgList, err := queue.GetMessages(&storage.GetMessagesOptions{NumOfMessages: 1})
 	if err != nil {
 		return "", err
@@ -153,7 +215,9 @@ func (qh QueueHandler) PopQueue(queueName string) (string, error) {
 
 	if len(msgList) > 0 {
 		// make sure its marked as read!
-		msgList[0].Delete(nil)
+		if err := queue.DeleteMessage(msgList[0], nil); err != nil {
+			return "", err
+		}
 
 		// just really interested in the content.
 		return msgList[0].Text, nil
@@ -178,6 +242,10 @@ func (qh QueueHandler) PeekQueue(queueName string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+
+	if len(msgList) == 0 {
+		return "", nil
+	}
 	return msgList[0].Text, nil
 }
 
@@ -199,5 +267,5 @@ func (qh QueueHandler) QueueSize(queueName string) (uint64, error) {
 	}
 
 	log.Debugf("queue %v", queue)
-	return queue.AproxMessageCount, nil
+	return queue.ApproximateMessageCount(), nil
 }
@@ -0,0 +1,139 @@
+package Handler
+
+import (
+	"testing"
+)
+
+// queue every test works in.
+const testQueue = "test"
+
+// newTestHandler creates a QueueHandler backed by a MemoryQueueService with the test queue holding messages, in order.
+func newTestHandler(t *testing.T, messages ...string) *QueueHandler {
+	qh := NewQueueHandlerWithService("account", "", NewMemoryQueueService())
+	if err := qh.CreateQueue(testQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range messages {
+		if err := qh.PushQueue(testQueue, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return qh
+}
+
+// queueSize returns the number of messages in the test queue.
+func queueSize(t *testing.T, qh *QueueHandler) uint64 {
+	size, err := qh.QueueSize(testQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return size
+}
+
+func TestPopQueue(t *testing.T) {
+	qh := newTestHandler(t, "one", "two")
+
+	for _, expected := range []string{"one", "two", ""} {
+		message, err := qh.PopQueue(testQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message != expected {
+			t.Errorf("got %q, expected %q", message, expected)
+		}
+	}
+
+	if size := queueSize(t, qh); size != 0 {
+		t.Errorf("got %d messages after popping them all, expected none", size)
+	}
+}
+
+func TestPeekQueue(t *testing.T) {
+	qh := newTestHandler(t, "one", "two")
+
+	// peeking leaves the message at the front.
+	for i := 0; i < 2; i++ {
+		message, err := qh.PeekQueue(testQueue)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if message != "one" {
+			t.Errorf("got %q, expected one", message)
+		}
+	}
+
+	if size := queueSize(t, qh); size != 2 {
+		t.Errorf("got %d messages after peeking, expected 2", size)
+	}
+
+	empty := newTestHandler(t)
+	if message, err := empty.PeekQueue(testQueue); err != nil || message != "" {
+		t.Errorf("got %q (%v) peeking an empty queue", message, err)
+	}
+}
+
+func TestClearQueue(t *testing.T) {
+	qh := newTestHandler(t, "one", "two", "three")
+
+	// a popped message is removed, not just hidden, so it's not part of the count before clearing.
+	if _, err := qh.PopQueue(testQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := queueSize(t, qh); size != 2 {
+		t.Errorf("got %d messages, expected 2", size)
+	}
+
+	if err := qh.ClearQueue(testQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := queueSize(t, qh); size != 0 {
+		t.Errorf("got %d messages after clearing, expected none", size)
+	}
+}
+
+func TestDryRunLeavesQueue(t *testing.T) {
+	qh := newTestHandler(t, "one", "two")
+	qh.SetDryRun(true)
+
+	message, err := qh.PopQueue(testQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if message != "one" {
+		t.Errorf("got %q from a dry run pop, expected one", message)
+	}
+
+	if err := qh.PushQueue(testQueue, "three"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := qh.ClearQueue(testQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := queueSize(t, qh); size != 2 {
+		t.Errorf("got %d messages after dry runs, expected 2", size)
+	}
+}
+
+func TestMissingQueue(t *testing.T) {
+	qh := NewQueueHandlerWithService("account", "", NewMemoryQueueService())
+
+	if _, err := qh.PopQueue("missing"); err == nil {
+		t.Errorf("expected an error popping a queue that doesn't exist")
+	}
+
+	if _, err := qh.PeekQueue("missing"); err == nil {
+		t.Errorf("expected an error peeking a queue that doesn't exist")
+	}
+
+	if err := qh.ClearQueue("missing"); err == nil {
+		t.Errorf("expected an error clearing a queue that doesn't exist")
+	}
+}
@@ -0,0 +1,74 @@
+package Handler
+
+import (
+	"azure-sdk-for-go/storage"
+)
+
+// QueueService is the part of the queue storage client that QueueHandler uses.
+// Real one wraps storage.QueueServiceClient, MemoryQueueService is an in-memory fake.
+type QueueService interface {
+	GetQueueReference(name string) Queue
+}
+
+// Queue is the part of storage.Queue (and its messages) that QueueHandler uses.
+type Queue interface {
+	Exists() (bool, error)
+	Create(options *storage.QueueServiceOptions) error
+	ClearMessages(options *storage.QueueServiceOptions) error
+	GetMetadata(options *storage.QueueServiceOptions) error
+	ApproximateMessageCount() uint64
+
+	PutMessage(text string, options *storage.PutMessageOptions) error
+	GetMessages(options *storage.GetMessagesOptions) ([]storage.Message, error)
+	PeekMessages(options *storage.PeekMessagesOptions) ([]storage.Message, error)
+	DeleteMessage(message storage.Message, options *storage.QueueServiceOptions) error
+}
+
+// azureQueueService is the QueueService backed by Azure.
+type azureQueueService struct {
+	client storage.QueueServiceClient
+}
+
+func (s azureQueueService) GetQueueReference(name string) Queue {
+	return azureQueue{queue: s.client.GetQueueReference(name)}
+}
+
+type azureQueue struct {
+	queue *storage.Queue
+}
+
+func (q azureQueue) Exists() (bool, error) {
+	return q.queue.Exists()
+}
+
+func (q azureQueue) Create(options *storage.QueueServiceOptions) error {
+	return q.queue.Create(options)
+}
+
+func (q azureQueue) ClearMessages(options *storage.QueueServiceOptions) error {
+	return q.queue.ClearMessages(options)
+}
+
+func (q azureQueue) GetMetadata(options *storage.QueueServiceOptions) error {
+	return q.queue.GetMetadata(options)
+}
+
+func (q azureQueue) ApproximateMessageCount() uint64 {
+	return q.queue.AproxMessageCount
+}
+
+func (q azureQueue) PutMessage(text string, options *storage.PutMessageOptions) error {
+	return q.queue.GetMessageReference(text).Put(options)
+}
+
+func (q azureQueue) GetMessages(options *storage.GetMessagesOptions) ([]storage.Message, error) {
+	return q.queue.GetMessages(options)
+}
+
+func (q azureQueue) PeekMessages(options *storage.PeekMessagesOptions) ([]storage.Message, error) {
+	return q.queue.PeekMessages(options)
+}
+
+func (q azureQueue) DeleteMessage(message storage.Message, options *storage.QueueServiceOptions) error {
+	return message.Delete(options)
+}
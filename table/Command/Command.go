@@ -0,0 +1,15 @@
+package Command
+
+import (
+	"azurestoragetools/common"
+	"errors"
+)
+
+// Tool is asttable, "ast table". Nothing is implemented yet.
+var Tool = common.Tool{
+	Name:    "table",
+	Summary: "Azure Storage Tools Table. This is NOT implemented yet.",
+	Run: func(config *common.CloudConfig) error {
+		return errors.New("asttable is not implemented yet")
+	},
+}
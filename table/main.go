@@ -1,6 +1,11 @@
 package main
 
+import (
+	"azurestoragetools/table/Command"
+	"os"
+)
+
 // "so it begins"
 func main() {
-
+	os.Exit(Command.Tool.Main("asttable", os.Args[1:]))
 }